@@ -2,7 +2,11 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"math/big"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/cijin/go-interpreter/token"
 )
@@ -10,6 +14,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // first character of the node
+	End() token.Position // first character after the node
 }
 
 type Statement interface {
@@ -24,6 +30,9 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+
+	// Comments in source order, only filled in when the lexer keeps them
+	Comments []*Comment `dump:"-"`
 }
 
 func (p *Program) TokenLiteral() string {
@@ -34,6 +43,22 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var buf bytes.Buffer
 
@@ -44,6 +69,17 @@ func (p *Program) String() string {
 	return buf.String()
 }
 
+// Comment is a `//` or `/* */` comment, including the delimiters. It is not
+// part of the tree, tools find where it belongs from its position
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+func (c *Comment) End() token.Position  { return c.Token.End }
+func (c *Comment) String() string       { return c.Token.Literal }
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -51,6 +87,8 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) End() token.Position  { return i.Token.End }
 func (i *Identifier) String() string       { return i.Value }
 
 type Boolean struct {
@@ -60,17 +98,43 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
+func (b *Boolean) End() token.Position  { return b.Token.End }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (n *NullLiteral) expressionNode()      {}
+func (n *NullLiteral) TokenLiteral() string { return n.Token.Literal }
+func (n *NullLiteral) Pos() token.Position  { return n.Token.Pos }
+func (n *NullLiteral) End() token.Position  { return n.Token.End }
+func (n *NullLiteral) String() string       { return n.Token.Literal }
+
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal doesn't fit in an int64
 }
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Pos }
+func (i *IntegerLiteral) End() token.Position  { return i.Token.End }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) Pos() token.Position  { return f.Token.Pos }
+func (f *FloatLiteral) End() token.Position  { return f.Token.End }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -78,7 +142,148 @@ type StringLiteral struct {
 
 func (i *StringLiteral) expressionNode()      {}
 func (i *StringLiteral) TokenLiteral() string { return i.Token.Literal }
-func (i *StringLiteral) String() string       { return i.Token.Literal }
+func (i *StringLiteral) Pos() token.Position  { return i.Token.Pos }
+func (i *StringLiteral) End() token.Position  { return i.Token.End }
+
+// String gives the literal back as source, raw strings stay raw and
+// anything else is quoted and escaped so it reads back to the same value
+func (i *StringLiteral) String() string {
+	if i.Token.Type == token.RAW_STRING {
+		return "`" + i.Value + "`"
+	}
+
+	return quote(i.Value)
+}
+
+func quote(s string) string {
+	return `"` + Escape(s) + `"`
+}
+
+// Escape escapes s to go between double quotes, the opposite of what the
+// lexer does with escape sequences
+func Escape(s string) string {
+	var buf bytes.Buffer
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '$' && strings.HasPrefix(s[i+1:], "{"):
+			buf.WriteString(`\$`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == utf8.RuneError && size == 1:
+			// a byte that isn't valid utf-8, from a \x escape
+			fmt.Fprintf(&buf, `\x%02x`, s[i])
+		case r < 0x80 && !unicode.IsPrint(r):
+			fmt.Fprintf(&buf, `\x%02x`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&buf, `\u{%x}`, r)
+		default:
+			buf.WriteString(s[i : i+size])
+		}
+
+		i += size
+	}
+
+	return buf.String()
+}
+
+/*
+InterpolatedString is a string with expressions embedded in it. The parts
+alternate between literal text and expressions, starting and ending with
+text: "a ${b} c" has the parts "a ", b and " c". Text parts are kept even
+when empty.
+*/
+type InterpolatedString struct {
+	Token token.Token // the INTERP_HEAD token
+	Parts []Expression
+	Tail  token.Token // the INTERP_TAIL token
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position  { return is.Tail.End }
+func (is *InterpolatedString) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(`"`)
+	for i, part := range is.Parts {
+		if lit, ok := part.(*StringLiteral); ok && i%2 == 0 {
+			buf.WriteString(Escape(lit.Value))
+			continue
+		}
+
+		buf.WriteString("${" + part.String() + "}")
+	}
+	buf.WriteString(`"`)
+
+	return buf.String()
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // [ token
+	Elements []Expression
+	Rbracket token.Token
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position  { return al.Rbracket.End }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	var elements []string
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Hash literal, pairs are kept in source order
+type HashLiteral struct {
+	Token  token.Token // { token
+	Pairs  []HashPair
+	Rbrace token.Token
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position  { return hl.Rbrace.End }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	var pairs []string
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
 
 // Let
 type LetStatement struct {
@@ -89,6 +294,8 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position  { return endOf(ls.Value, ls.Name.Token) }
 func (ls *LetStatement) String() string {
 	var buf bytes.Buffer
 
@@ -105,6 +312,33 @@ func (ls *LetStatement) String() string {
 	return buf.String()
 }
 
+// Const, like let but the binding can't be changed afterwards
+type ConstStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ConstStatement) End() token.Position  { return endOf(cs.Value, cs.Name.Token) }
+func (cs *ConstStatement) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(cs.TokenLiteral() + " ")
+	buf.WriteString(cs.Name.TokenLiteral())
+	buf.WriteString(" = ")
+
+	if cs.Value != nil {
+		buf.WriteString(cs.Value.String())
+	}
+
+	buf.WriteString(";")
+
+	return buf.String()
+}
+
 // Return
 type ReturnStatement struct {
 	Token       token.Token
@@ -113,6 +347,8 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position  { return endOf(rs.ReturnValue, rs.Token) }
 func (rs *ReturnStatement) String() string {
 	var buf bytes.Buffer
 
@@ -127,6 +363,98 @@ func (rs *ReturnStatement) String() string {
 	return buf.String()
 }
 
+// while (condition) { body }
+type WhileStatement struct {
+	Token     token.Token // while token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position  { return ws.Body.End() }
+func (ws *WhileStatement) String() string {
+	return ws.TokenLiteral() + " (" + ws.Condition.String() + ") " + ws.Body.String()
+}
+
+// for (variable in iterable) { body }
+type ForStatement struct {
+	Token    token.Token // for token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position  { return fs.Body.End() }
+func (fs *ForStatement) String() string {
+	return fs.TokenLiteral() + " (" + fs.Variable.String() + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+}
+
+// break & continue, Token is the keyword
+type BranchStatement struct {
+	Token token.Token
+}
+
+func (bs *BranchStatement) statementNode()       {}
+func (bs *BranchStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BranchStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BranchStatement) End() token.Position  { return bs.Token.End }
+func (bs *BranchStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+// throw value;
+type ThrowStatement struct {
+	Token token.Token // throw token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position  { return endOf(ts.Value, ts.Token) }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// try { body } catch (param) { catch } finally { finally }, either the
+// catch or the finally block may be left out
+type TryStatement struct {
+	Token   token.Token // try token
+	Body    *BlockStatement
+	Param   *Identifier // nil without a catch block
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *TryStatement) End() token.Position {
+	if ts.Finally != nil {
+		return ts.Finally.End()
+	}
+
+	return ts.Catch.End()
+}
+func (ts *TryStatement) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(ts.TokenLiteral() + " " + ts.Body.String())
+
+	if ts.Catch != nil {
+		buf.WriteString(" catch (" + ts.Param.String() + ") " + ts.Catch.String())
+	}
+
+	if ts.Finally != nil {
+		buf.WriteString(" finally " + ts.Finally.String())
+	}
+
+	return buf.String()
+}
+
 // if else expression
 type IfExpression struct {
 	Token       token.Token // if token
@@ -137,6 +465,14 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+
+	return ie.Consequence.End()
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -161,6 +497,8 @@ type FunctionLiteral struct {
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position  { return fl.Body.End() }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	var params []string
@@ -179,12 +517,15 @@ func (fl *FunctionLiteral) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // { token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position  { return bs.Rbrace.End }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -196,13 +537,16 @@ func (bs *BlockStatement) String() string {
 }
 
 type CallExpression struct {
-	Token     token.Token
+	Token     token.Token // ( token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position  { return ce.Rparen.End }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -219,6 +563,38 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+/*
+IndexExpression is xs[i], or xs?[i] & h?.key when Optional is set. The key
+of h?.key is a *StringLiteral made from the name, with Rbracket set to the
+name's token as there is no bracket.
+*/
+type IndexExpression struct {
+	Token    token.Token // [, ?[ or ?. token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
+	Optional bool // the result is null rather than indexing when Left is null
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position  { return ie.Rbracket.End }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?")
+	}
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // Prefix Operator
 type PrefixExpression struct {
 	Token    token.Token
@@ -228,6 +604,8 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position  { return endOf(pe.Right, pe.Token) }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -249,6 +627,8 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Left.Pos() }
+func (ie *InfixExpression) End() token.Position  { return endOf(ie.Right, ie.Token) }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -261,6 +641,31 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// Assignment, x = 1 or xs[0] += 1. Target is either an *Identifier or an
+// *IndexExpression, Operator is = or one of the compound operators
+type AssignExpression struct {
+	Token    token.Token // the assignment operator
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Target.Pos() }
+func (ae *AssignExpression) End() token.Position  { return endOf(ae.Value, ae.Token) }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // Wrapper around expressions
 type ExpressionStatement struct {
 	Token      token.Token
@@ -272,6 +677,9 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position { return endOf(es.Expression, es.Token) }
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -279,3 +687,13 @@ func (es *ExpressionStatement) String() string {
 
 	return ""
 }
+
+// end of an optional child node, falling back to the end of the token
+// preceding it when the parser could not produce the child
+func endOf(n Node, prev token.Token) token.Position {
+	if n == nil {
+		return prev.End
+	}
+
+	return n.End()
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/cijin/go-interpreter/token"
@@ -37,3 +38,65 @@ func TestString(t *testing.T) {
 		t.Errorf("Expected %s, got='%s'\n", expected, program.String())
 	}
 }
+
+func TestStringLiteralString(t *testing.T) {
+	tests := []struct {
+		lit      *StringLiteral
+		expected string
+	}{
+		{&StringLiteral{Value: "hello"}, `"hello"`},
+		{&StringLiteral{Value: "say \"hi\"\\n"}, `"say \"hi\"\\n"`},
+		{&StringLiteral{Value: "a\tb\r\nc"}, `"a\tb\r\nc"`},
+		{&StringLiteral{Value: "\x00\x7f\xff"}, `"\x00\x7f\xff"`},
+		{&StringLiteral{Value: "héllo 😀\u200b"}, `"héllo 😀\u{200b}"`},
+		{&StringLiteral{Token: token.Token{Type: token.RAW_STRING}, Value: "a\\n\nb"}, "`a\\n\nb`"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.lit.String(); got != tt.expected {
+			t.Errorf("wrong string for %q. expected=%s, got=%s", tt.lit.Value, tt.expected, got)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: token.Position{Line: 1, Column: 1}},
+				Name: &Identifier{
+					Token: token.Token{
+						Type:    token.IDENT,
+						Literal: "x",
+						Pos:     token.Position{Line: 1, Column: 5},
+						End:     token.Position{Line: 1, Column: 6},
+					},
+					Value: "x",
+				},
+				Value: &ArrayLiteral{
+					Token:    token.Token{Type: token.LBRACKET, Literal: "[", Pos: token.Position{Line: 1, Column: 9}},
+					Elements: []Expression{},
+					Rbracket: token.Token{Type: token.RBRACKET, Literal: "]", End: token.Position{Line: 1, Column: 11}},
+				},
+			},
+		},
+	}
+
+	expected := `Program 1:1-1:11
+  Statements: (len = 1)
+    0: LetStatement 1:1-1:11
+      Name: Identifier 1:5-1:6
+        Value: "x"
+      Value: ArrayLiteral 1:9-1:11
+        Elements: (len = 0)
+`
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, program); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
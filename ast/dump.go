@@ -0,0 +1,99 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/cijin/go-interpreter/token"
+)
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+/*
+ * Dump writes an indented tree of the node and all of its children, one
+ * node per line along with the source range it covers. Fields are found
+ * through reflection so new nodes show up without having to touch this.
+ *
+ *   Program 1:1-1:10
+ *     LetStatement 1:1-1:10
+ *       Name: Identifier 1:5-1:6
+ *         Value: "x"
+ */
+func Dump(w io.Writer, node Node) error {
+	d := &dumper{w: w}
+	d.node("", reflect.ValueOf(node), 0)
+
+	return d.err
+}
+
+type dumper struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dumper) printf(depth int, format string, a ...interface{}) {
+	if d.err != nil {
+		return
+	}
+
+	_, d.err = fmt.Fprintf(d.w, strings.Repeat("  ", depth)+format+"\n", a...)
+}
+
+func (d *dumper) node(label string, v reflect.Value, depth int) {
+	if (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) && v.IsNil() {
+		d.printf(depth, "%snil", label)
+		return
+	}
+
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	n := v.Interface().(Node)
+	d.printf(depth, "%s%s %s-%s", label, v.Elem().Type().Name(), n.Pos(), n.End())
+	d.fields(v.Elem(), depth+1)
+}
+
+func (d *dumper) fields(v reflect.Value, depth int) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Type == tokenType || field.Tag.Get("dump") == "-" {
+			continue
+		}
+
+		d.value(field.Name+": ", v.Field(i), depth)
+	}
+}
+
+func (d *dumper) value(label string, v reflect.Value, depth int) {
+	switch {
+	case v.Type().Implements(nodeType):
+		d.node(label, v, depth)
+
+	// optional values that aren't set, like the big value of a small
+	// integer literal
+	case v.Kind() == reflect.Pointer && v.IsNil():
+		return
+
+	case v.Kind() == reflect.Slice:
+		d.printf(depth, "%s(len = %d)", label, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			d.value(fmt.Sprintf("%d: ", i), v.Index(i), depth+1)
+		}
+
+	case v.Kind() == reflect.Struct:
+		d.printf(depth, "%s%s", label, v.Type().Name())
+		d.fields(v, depth+1)
+
+	case v.Kind() == reflect.String:
+		d.printf(depth, "%s%q", label, v.String())
+
+	default:
+		d.printf(depth, "%s%v", label, v.Interface())
+	}
+}
@@ -0,0 +1,303 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterThanOrEqual
+	OpLessThanOrEqual
+
+	OpMinus
+	OpBang
+	OpBitNot
+
+	OpJumpNotTruthy
+	OpJump
+	OpJumpNull
+
+	OpIterator
+	OpIterNext
+
+	OpTry
+	OpPopTry
+	OpThrow
+	OpCatch
+	OpRaise
+
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpSetFree
+	OpCurrentClosure
+	OpCaptureLocal
+	OpCaptureFree
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpDup2
+	OpInterpolate
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+)
+
+// Definition of an opcode, each operand is OperandWidths[i] bytes wide
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	// index in to the constant pool
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+
+	OpMinus:  {"OpMinus", []int{}},
+	OpBang:   {"OpBang", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
+
+	// absolute offset to jump to
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	// only looks at the top of the stack, it is left there either way
+	OpJumpNull: {"OpJumpNull", []int{2}},
+
+	// turns the value on the stack in to an iterator
+	OpIterator: {"OpIterator", []int{}},
+	// absolute offset to jump to once the iterator on the stack is done
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	// absolute offset of the handler for errors until the matching OpPopTry,
+	// the vm jumps there with the error on the stack
+	OpTry:    {"OpTry", []int{2}},
+	OpPopTry: {"OpPopTry", []int{}},
+	// throws the value on the stack, an error handed to a handler is rethrown
+	OpThrow: {"OpThrow", []int{}},
+	// turns the error on the stack in to what a catch block sees of it
+	OpCatch: {"OpCatch", []int{}},
+	// index in to the constant pool of an error to raise, for mistakes the
+	// compiler finds that scripts can still catch
+	OpRaise: {"OpRaise", []int{2}},
+
+	// index of the binding
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	// like OpSetGlobal, but the global has to be set already
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	// push the binding itself rather than its value, for a closure to share
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+
+	// number of elements on the stack, for hashes that is keys + values
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	// collection, index & value on the stack, leaves the value
+	OpSetIndex: {"OpSetIndex", []int{}},
+	// duplicates the top two elements of the stack
+	OpDup2: {"OpDup2", []int{}},
+	// number of parts on the stack, joined in to a single string
+	OpInterpolate: {"OpInterpolate", []int{2}},
+
+	// number of arguments
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	// constant index of the function & number of free variables
+	OpClosure: {"OpClosure", []int{2, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// CheckOperands reports an operand too big for its width, Make would cut
+// it down and encode a different instruction than the one meant
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+
+	for i, o := range operands {
+		max := 1<<(8*def.OperandWidths[i]) - 1
+		if o < 0 || o > max {
+			return fmt.Errorf("operand %d of %s out of range: %d, max=%d", i+1, def.Name, o, max)
+		}
+	}
+
+	return nil
+}
+
+// Make encodes an instruction, operands are written big endian. Operands
+// must fit their width, see CheckOperands.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, it is the inverse
+// of Make and returns the operands along with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
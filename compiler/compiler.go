@@ -0,0 +1,1171 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cijin/go-interpreter/ast"
+	"github.com/cijin/go-interpreter/code"
+	"github.com/cijin/go-interpreter/object"
+	"github.com/cijin/go-interpreter/token"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// every function literal is compiled in its own scope
+type CompilationScope struct {
+	instructions        code.Instructions
+	positions           map[int]token.Position
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// loops & try blocks around the code being compiled, innermost last
+	loops []*loop
+	tries []tryBlock
+}
+
+type loop struct {
+	start  int   // where continue jumps to
+	breaks []int // jumps out of the loop, patched once its end is known
+}
+
+type tryBlock struct {
+	finally *ast.BlockStatement // nil for a try block that only catches
+	loops   int                 // how many loops are around the try block
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	builtins    *object.BuiltinRegistry
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// position of the node being compiled, recorded for every instruction
+	// emitted so the vm can report where a runtime error happened
+	pos token.Position
+
+	// the first operand emitted that didn't fit its width, like a jump past
+	// 65535 bytes of instructions or a 256th local. It is returned once the
+	// node being compiled is done, saving every emit from returning errors.
+	err error
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    map[int]token.Position
+	Constants    []object.Object
+	Globals      []string // names of the globals, indexed by symbol index
+
+	// where the globals declared with const were declared, by symbol index
+	ConstGlobals map[int]token.Position
+
+	// what the builtins were compiled against, the vm looks them up there
+	Builtins *object.BuiltinRegistry
+}
+
+var infixOperators = map[string]code.Opcode{
+	token.PLUS:     code.OpAdd,
+	token.MINUS:    code.OpSub,
+	token.ASTERISK: code.OpMul,
+	token.SLASH:    code.OpDiv,
+	token.PERCENT:  code.OpMod,
+	token.BIT_AND:  code.OpBitAnd,
+	token.BIT_OR:   code.OpBitOr,
+	token.BIT_XOR:  code.OpBitXor,
+	token.SHL:      code.OpShiftLeft,
+	token.SHR:      code.OpShiftRight,
+	token.GT:       code.OpGreaterThan,
+	token.LT:       code.OpLessThan,
+	token.GT_EQ:    code.OpGreaterThanOrEqual,
+	token.LT_EQ:    code.OpLessThanOrEqual,
+	token.EQ:       code.OpEqual,
+	token.NOT_EQ:   code.OpNotEqual,
+}
+
+func New() *Compiler {
+	return NewWithBuiltins(object.Builtins)
+}
+
+// NewWithBuiltins compiles names to the builtins of r rather than the
+// default ones, like an enviornment given them with SetBuiltins
+func NewWithBuiltins(r *object.BuiltinRegistry) *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, name := range r.Names() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return NewWithState(symbolTable, []object.Object{}, r)
+}
+
+// NewWithState keeps globals & constants around between compilations, the
+// repl uses this to remember bindings from earlier lines. s must have the
+// builtins of r defined, in the same order.
+func NewWithState(s *SymbolTable, constants []object.Object, r *object.BuiltinRegistry) *Compiler {
+	mainScope := CompilationScope{positions: make(map[int]token.Position)}
+
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		builtins:    r,
+		scopes:      []CompilationScope{mainScope},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = prevPos }()
+
+	switch n := node.(type) {
+	case *ast.Program:
+		for _, s := range n.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if n.Expression == nil {
+			return nil
+		}
+
+		if err := c.Compile(n.Expression); err != nil {
+			return err
+		}
+
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range n.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if c.checkRedeclaration(n.Name.Value, n.Pos()) {
+			break
+		}
+
+		var err error
+		if fl, ok := n.Value.(*ast.FunctionLiteral); ok {
+			err = c.compileFunction(fl, n.Name.Value)
+		} else {
+			err = c.Compile(n.Value)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.Define(n.Name.Value)
+		c.setSymbol(symbol)
+
+	case *ast.WhileStatement:
+		if err := c.compileWhileStatement(n); err != nil {
+			return err
+		}
+
+	case *ast.ForStatement:
+		if err := c.compileForStatement(n); err != nil {
+			return err
+		}
+
+	case *ast.BranchStatement:
+		loops := c.scopes[c.scopeIndex].loops
+		if len(loops) == 0 {
+			return fmt.Errorf("%s: %s outside of a loop", n.Pos(), n.TokenLiteral())
+		}
+
+		if err := c.leaveTries(len(loops)); err != nil {
+			return err
+		}
+
+		current := loops[len(loops)-1]
+		if n.Token.Type == token.BREAK {
+			current.breaks = append(current.breaks, c.emit(code.OpJump, 9999))
+		} else {
+			c.emit(code.OpJump, current.start)
+		}
+
+	case *ast.ConstStatement:
+		if c.checkRedeclaration(n.Name.Value, n.Pos()) {
+			break
+		}
+
+		var err error
+		if fl, ok := n.Value.(*ast.FunctionLiteral); ok {
+			err = c.compileFunction(fl, n.Name.Value)
+		} else {
+			err = c.Compile(n.Value)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.DefineConst(n.Name.Value, n.Pos())
+		c.setSymbol(symbol)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(n.ReturnValue); err != nil {
+			return err
+		}
+
+		// the value waits on the stack while finally blocks run
+		if err := c.leaveTries(0); err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(n.Value); err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+
+	case *ast.TryStatement:
+		if err := c.compileTryStatement(n); err != nil {
+			return err
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(n.Value)
+		if !ok && c.loadNamespace(n.Value) {
+			break
+		}
+
+		if !ok {
+			/*
+			 * Unknown names are assumed to be globals defined later on, so
+			 * functions can call functions declared after them. The vm
+			 * reports an error if the global is still unset when read.
+			 */
+			c.symbolTable.global().Define(n.Value)
+			symbol, _ = c.symbolTable.Resolve(n.Value)
+		}
+
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: n.Value}
+		if n.Big != nil {
+			integer = &object.BigInt{Value: n.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: n.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: n.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
+	case *ast.Boolean:
+		if n.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(n.Right); err != nil {
+			return err
+		}
+
+		switch n.Operator {
+		case token.BANG:
+			c.emit(code.OpBang)
+		case token.MINUS:
+			c.emit(code.OpMinus)
+		case token.BIT_NOT:
+			c.emit(code.OpBitNot)
+		default:
+			return fmt.Errorf("%s: unknown operator: %s", n.Pos(), n.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if n.Operator == token.AND || n.Operator == token.OR {
+			return c.compileLogicalExpression(n)
+		}
+
+		if n.Operator == token.NULLISH {
+			return c.compileNullishExpression(n)
+		}
+
+		op, ok := infixOperators[n.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator: %s", n.Pos(), n.Operator)
+		}
+
+		if err := c.Compile(n.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(n.Right); err != nil {
+			return err
+		}
+
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.compileIfExpression(n); err != nil {
+			return err
+		}
+
+	case *ast.FunctionLiteral:
+		if err := c.compileFunction(n, ""); err != nil {
+			return err
+		}
+
+	case *ast.CallExpression:
+		if err := c.Compile(n.Function); err != nil {
+			return err
+		}
+
+		for _, a := range n.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(n.Arguments))
+
+	case *ast.ArrayLiteral:
+		for _, el := range n.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(n.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range n.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(n.Pairs)*2)
+
+	case *ast.InterpolatedString:
+		for _, part := range n.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpInterpolate, len(n.Parts))
+
+	case *ast.AssignExpression:
+		if err := c.compileAssignExpression(n); err != nil {
+			return err
+		}
+
+	case *ast.IndexExpression:
+		if err := c.Compile(n.Left); err != nil {
+			return err
+		}
+
+		// a null on the left is the result of an optional access
+		jumpNullPos := -1
+		if n.Optional {
+			jumpNullPos = c.emit(code.OpJumpNull, 9999)
+		}
+
+		if err := c.Compile(n.Index); err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+		if jumpNullPos >= 0 {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+
+	default:
+		return fmt.Errorf("%s: cannot compile %T", node.Pos(), node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(n *ast.IfExpression) error {
+	if err := c.Compile(n.Condition); err != nil {
+		return err
+	}
+
+	// bogus offset, patched once the consequence has been compiled
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(n.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if n.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(n.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+/*
+compileWhileStatement checks the condition before every pass, loops leave
+nothing on the stack.
+
+	start:
+	  condition
+	  OpJumpNotTruthy end
+	  body
+	  OpJump start
+	end:
+*/
+func (c *Compiler) compileWhileStatement(n *ast.WhileStatement) error {
+	start := len(c.currentInstructions())
+
+	if err := c.Compile(n.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileLoopBody(n.Body, start); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+/*
+compileForStatement keeps the iterator in a hidden binding, named after how
+deeply the loop is nested so nested loops each get their own.
+
+	  iterable
+	  OpIterator
+	  OpSet $iter
+	start:
+	  OpGet $iter
+	  OpIterNext end
+	  OpSet variable
+	  body
+	  OpJump start
+	end:
+*/
+func (c *Compiler) compileForStatement(n *ast.ForStatement) error {
+	if c.checkRedeclaration(n.Variable.Value, n.Pos()) {
+		return nil
+	}
+
+	if err := c.Compile(n.Iterable); err != nil {
+		return err
+	}
+
+	c.emit(code.OpIterator)
+
+	iterator := c.symbolTable.Define(fmt.Sprintf("$iter%d", len(c.scopes[c.scopeIndex].loops)))
+	c.setSymbol(iterator)
+
+	start := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	iterNextPos := c.emit(code.OpIterNext, 9999)
+
+	variable := c.symbolTable.Define(n.Variable.Value)
+	c.setSymbol(variable)
+
+	if err := c.compileLoopBody(n.Body, start); err != nil {
+		return err
+	}
+
+	c.changeOperand(iterNextPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+/*
+compileTryStatement runs the try block with a handler set up for errors. A
+try statement with both a catch & a finally block is compiled as a finally
+around a catch.
+
+	  OpTry catch               OpTry handler
+	  body                      body
+	  OpPopTry                  OpPopTry
+	  OpJump end                finally
+	catch:                      OpJump end
+	  OpCatch                 handler:
+	  OpSet param               OpSet $err
+	  catch                     finally
+	end:                        OpGet $err
+	                            OpThrow
+	                          end:
+
+Returns, breaks & continues that leave a try block pop its handler & run
+its finally block on their way out, see leaveTries.
+*/
+func (c *Compiler) compileTryStatement(n *ast.TryStatement) error {
+	if n.Finally == nil {
+		return c.compileTryCatch(n)
+	}
+
+	tryPos, err := c.compileTryBlock(n.Finally, func() error {
+		if n.Catch == nil {
+			return c.Compile(n.Body)
+		}
+
+		return c.compileTryCatch(n)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Compile(n.Finally); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	// named after the OpTry, so try statements in the finally block don't
+	// overwrite it
+	caught := c.symbolTable.Define(fmt.Sprintf("$err%d", tryPos))
+	c.setSymbol(caught)
+
+	if err := c.Compile(n.Finally); err != nil {
+		return err
+	}
+
+	c.loadSymbol(caught)
+	c.emit(code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// the caught error is bound in the scope the try statement is in, like the
+// variable of a for loop
+func (c *Compiler) compileTryCatch(n *ast.TryStatement) error {
+	if c.checkRedeclaration(n.Param.Value, n.Pos()) {
+		return nil
+	}
+
+	tryPos, err := c.compileTryBlock(nil, func() error { return c.Compile(n.Body) })
+	if err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	c.emit(code.OpCatch)
+	param := c.symbolTable.Define(n.Param.Value)
+	c.setSymbol(param)
+
+	if err := c.Compile(n.Catch); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	// an OpPop or OpReturnValue ending the catch block mustn't be taken for
+	// the end of the statement, which leaves no value behind
+	c.setLastInstruction(code.OpJump, jumpPos)
+
+	return nil
+}
+
+// compileTryBlock compiles body between an OpTry & an OpPopTry, returning
+// the position of the OpTry for the caller to point at the handler
+func (c *Compiler) compileTryBlock(finally *ast.BlockStatement, body func() error) (int, error) {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, tryBlock{finally: finally, loops: len(scope.loops)})
+
+	err := body()
+
+	// functions in the body may have grown c.scopes, so look it up again
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+
+	if err != nil {
+		return 0, err
+	}
+
+	c.emit(code.OpPopTry)
+
+	return tryPos, nil
+}
+
+/*
+leaveTries comes before a return, break or continue jumps out of try blocks,
+it pops their handlers & compiles their finally blocks in to the jump,
+innermost first. Breaks & continues leave the try blocks inside the
+innermost loop, so they pass how many loops there are. Returns leave every
+try block in the function & pass 0.
+
+A finally block is compiled as if it was where its try statement is, with
+only the loops & try blocks around that in scope.
+*/
+func (c *Compiler) leaveTries(loops int) error {
+	scope := &c.scopes[c.scopeIndex]
+	savedLoops, savedTries := scope.loops, scope.tries
+
+	defer func() {
+		scope := &c.scopes[c.scopeIndex]
+		scope.loops, scope.tries = savedLoops, savedTries
+	}()
+
+	for i := len(savedTries) - 1; i >= 0 && savedTries[i].loops >= loops; i-- {
+		try := savedTries[i]
+
+		// capped, so loops & try blocks in the finally block append to
+		// copies rather than overwriting the ones being left
+		scope := &c.scopes[c.scopeIndex]
+		scope.loops = savedLoops[:try.loops:try.loops]
+		scope.tries = savedTries[:i:i]
+
+		c.emit(code.OpPopTry)
+
+		if try.finally == nil {
+			continue
+		}
+
+		if err := c.Compile(try.finally); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileLoopBody compiles the body followed by the jump back to start,
+// breaks inside it jump to just after that
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, start int) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{start: start})
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+
+	// functions in the body may have grown c.scopes, so look it up again
+	scope = &c.scopes[c.scopeIndex]
+	current := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range current.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+/*
+compileAssignExpression leaves the assigned value on the stack. Compound
+operators read the current value before the right hand side is evaluated,
+for index expressions the collection & index are duplicated to do so.
+
+	x += v                      xs[i] += v
+	  OpGet x                     xs
+	  v                           i
+	  OpAdd                       OpDup2
+	  OpSet x                     OpIndex
+	  OpGet x                     v
+	                              OpAdd
+	                              OpSetIndex
+*/
+func (c *Compiler) compileAssignExpression(n *ast.AssignExpression) error {
+	var op code.Opcode
+	if n.Operator != token.ASSIGN {
+		// += is + and so on
+		op = infixOperators[strings.TrimSuffix(n.Operator, "=")]
+	}
+
+	switch target := n.Target.(type) {
+	case *ast.Identifier:
+		if symbol, ok := c.symbolTable.Resolve(target.Value); ok && symbol.Const {
+			// before the right hand side is evaluated, as the evaluator
+			// does
+			c.raise(object.NAME_ERROR, "cannot assign to const %s (declared at %s)", target.Value, symbol.Declared)
+			return nil
+		}
+
+		symbol, err := c.resolveAssignment(target)
+		if err != nil {
+			return err
+		}
+
+		if op != 0 {
+			c.loadSymbol(symbol)
+		}
+
+		if err := c.Compile(n.Value); err != nil {
+			return err
+		}
+
+		if op != 0 {
+			c.emit(op)
+		}
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		} else {
+			c.setSymbol(symbol)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+
+		if op != 0 {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+
+		if err := c.Compile(n.Value); err != nil {
+			return err
+		}
+
+		if op != 0 {
+			c.emit(op)
+		}
+
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", n.Pos(), n.Target)
+	}
+
+	return nil
+}
+
+// resolveAssignment finds the binding an assignment to ident updates
+func (c *Compiler) resolveAssignment(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		// like reads, unknown names are assumed to be globals defined
+		// later on, the vm checks they are set when assigning
+		c.symbolTable.global().Define(ident.Value)
+		symbol, _ = c.symbolTable.Resolve(ident.Value)
+	}
+
+	switch symbol.Scope {
+	case BuiltinScope:
+		return symbol, fmt.Errorf("%s: cannot assign to builtin %s", ident.Pos(), ident.Value)
+
+	case FunctionScope:
+		// the function's own name, which refers to the binding the
+		// function is being defined as. Only globals can be updated
+		// from inside the function as anything else isn't set yet.
+		outer, ok := c.symbolTable.Outer.Resolve(ident.Value)
+		if !ok && c.symbolTable.Outer.Outer == nil {
+			outer = c.symbolTable.global().Define(ident.Value)
+		} else if !ok || outer.Scope != GlobalScope {
+			return symbol, fmt.Errorf("%s: cannot assign to %s inside its own definition", ident.Pos(), ident.Value)
+		}
+
+		return outer, nil
+	}
+
+	return symbol, nil
+}
+
+// checkRedeclaration stops name being bound again in a scope that has it as
+// a constant, raising an error in place of the binding and reporting true.
+// Constants of enclosing functions can be shadowed, and the same const
+// statement may be compiled more than once, see leaveTries.
+func (c *Compiler) checkRedeclaration(name string, pos token.Position) bool {
+	symbol, ok := c.symbolTable.store[name]
+	if !ok || !symbol.Const || symbol.Scope == FreeScope || symbol.Declared == pos {
+		return false
+	}
+
+	c.raise(object.NAME_ERROR, "cannot redeclare const %s (declared at %s)", name, symbol.Declared)
+
+	return true
+}
+
+// raise compiles an error the vm raises when it gets there, for mistakes
+// the evaluator finds as it runs so scripts can catch them on both engines
+func (c *Compiler) raise(kind object.ErrorKind, format string, a ...interface{}) {
+	err := &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+	c.emit(code.OpRaise, c.addConstant(err))
+}
+
+/*
+compileLogicalExpression jumps over the right hand side when the left hand
+side settles the result. The side that decides is turned in to a boolean
+with two OpBangs, which follow the same truthiness as conditions do.
+
+	a && b                      a || b
+	  a                           a
+	  OpJumpNotTruthy false       OpJumpNotTruthy right
+	  b                           OpTrue
+	  OpBang                      OpJump end
+	  OpBang                    right:
+	  OpJump end                  b
+	false:                        OpBang
+	  OpFalse                     OpBang
+	end:                        end:
+*/
+func (c *Compiler) compileLogicalExpression(n *ast.InfixExpression) error {
+	if err := c.Compile(n.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if n.Operator == token.OR {
+		c.emit(code.OpTrue)
+	} else if err := c.compileBoolean(n.Right); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if n.Operator == token.AND {
+		c.emit(code.OpFalse)
+	} else if err := c.compileBoolean(n.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+/*
+compileNullishExpression only evaluates the right hand side when the left
+hand side is null.
+
+	  a
+	  OpJumpNull right
+	  OpJump end
+	right:
+	  OpPop
+	  b
+	end:
+*/
+func (c *Compiler) compileNullishExpression(n *ast.InfixExpression) error {
+	if err := c.Compile(n.Left); err != nil {
+		return err
+	}
+
+	jumpNullPos := c.emit(code.OpJumpNull, 9999)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+
+	c.emit(code.OpPop)
+	if err := c.Compile(n.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileBoolean leaves true or false on the stack, depending on whether
+// exp is truthy
+func (c *Compiler) compileBoolean(exp ast.Expression) error {
+	if err := c.Compile(exp); err != nil {
+		return err
+	}
+
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+
+	return nil
+}
+
+// compiles a block so it leaves its value on the stack, blocks that don't
+// end on an expression leave NULL like they do in the evaluator
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunction(fl *ast.FunctionLiteral, name string) error {
+	prevPos := c.pos
+	c.pos = fl.Pos()
+	defer func() { c.pos = prevPos }()
+
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range fl.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.Compile(fl.Body); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		Positions:     positions,
+		NumLocals:     numLocals,
+		NumParameters: len(fl.Parameters),
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+/*
+loadNamespace builds the hash of the builtins in the namespace name, a new
+one every time so scripts can't change it for one another. It reports false
+if there is no such namespace.
+
+	strings                       OpConstant "upper"
+	                              OpGetBuiltin strings.upper
+	                              OpHash 2
+*/
+func (c *Compiler) loadNamespace(name string) bool {
+	members := 0
+	for i, builtin := range c.builtins.Names() {
+		member, ok := strings.CutPrefix(builtin, name+".")
+		if !ok {
+			continue
+		}
+
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: member}))
+		c.emit(code.OpGetBuiltin, i)
+		members++
+	}
+
+	if members == 0 {
+		return false
+	}
+
+	c.emit(code.OpHash, members*2)
+
+	return true
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// captureSymbol pushes the binding of s rather than its value, so the
+// closure being made shares it with the scope it came from
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit returns the position of the emitted instruction
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.scopes[c.scopeIndex].positions[pos] = c.pos
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+		c.err = fmt.Errorf("%s: program too large: %s", c.pos, err)
+	}
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	delete(c.scopes[c.scopeIndex].positions, last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{positions: make(map[int]token.Position)}
+
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.global().Names(),
+		ConstGlobals: c.symbolTable.global().Consts(),
+		Builtins:     c.builtins,
+	}
+}
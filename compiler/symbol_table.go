@@ -0,0 +1,154 @@
+package compiler
+
+import "github.com/cijin/go-interpreter/token"
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+
+	// set for bindings declared with const, along with where they were
+	Const    bool
+	Declared token.Position
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// symbols from enclosing functions this table's function captures
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+
+	return s
+}
+
+/*
+ * Define binds name in this table. Defining a name that is already bound
+ * in the same table reuses the binding, the same way setting a name twice
+ * in an object.Enviornment overwrites it.
+ */
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+
+	return symbol
+}
+
+// DefineConst binds name like Define, marking the binding as a constant
+// declared at pos
+func (s *SymbolTable) DefineConst(name string, pos token.Position) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	symbol.Declared = pos
+	s.store[name] = symbol
+
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+
+	return symbol
+}
+
+// DefineFunctionName lets a function refer to itself while it is still
+// being defined, i.e. `let f = fn() { f() }`
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	symbol.Const, symbol.Declared = original.Const, original.Declared
+	s.store[original.Name] = symbol
+
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Names returns the names of the bindings defined in this table, indexed
+// by the index of their symbol
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index] = name
+		}
+	}
+
+	return names
+}
+
+// Consts returns where the constants in this table were declared, by the
+// index of their symbol
+func (s *SymbolTable) Consts() map[int]token.Position {
+	consts := make(map[int]token.Position)
+	for _, symbol := range s.store {
+		if symbol.Const && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+			consts[symbol.Index] = symbol.Declared
+		}
+	}
+
+	return consts
+}
+
+func (s *SymbolTable) global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s
+}
@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/cijin/go-interpreter/token"
+)
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("unexpected symbol for a: %+v", a)
+	}
+
+	b := global.Define("b")
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("unexpected symbol for b: %+v", b)
+	}
+
+	if again := global.Define("a"); again != a {
+		t.Errorf("expected redefining a to reuse %+v, got=%+v", a, again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+
+	c := local.Define("a")
+	if c != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("unexpected symbol for local a: %+v", c)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		result, ok := second.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0].Name != "b" {
+		t.Errorf("expected b to be captured, got=%+v", second.FreeSymbols)
+	}
+
+	if _, ok := second.Resolve("d"); ok {
+		t.Errorf("expected d to be unresolvable")
+	}
+}
+
+func TestDefineConst(t *testing.T) {
+	pos := token.Position{Line: 1, Column: 1}
+
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineConst("b", pos)
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineConst("c", pos)
+
+	inner := NewEnclosedSymbolTable(local)
+
+	expected := Symbol{Name: "c", Scope: FreeScope, Index: 0, Const: true, Declared: pos}
+	if result, _ := inner.Resolve("c"); result != expected {
+		t.Errorf("expected c to resolve to %+v, got=%+v", expected, result)
+	}
+
+	consts := global.Consts()
+	if len(consts) != 1 || consts[1] != pos {
+		t.Errorf("expected only b to be a constant, got=%+v", consts)
+	}
+}
+
+func TestNames(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+	global.Define("b")
+
+	names := global.Names()
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("expected [a b], got=%v", names)
+	}
+}
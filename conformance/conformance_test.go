@@ -0,0 +1,1060 @@
+/*
+ * The conformance suite runs the same programs through the tree walking
+ * evaluator & the bytecode vm and checks both agree on the result. Every
+ * case from evaluator_test.go that does not depend on how an engine
+ * represents functions internally is mirrored here.
+ */
+package conformance
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cijin/go-interpreter/compiler"
+	"github.com/cijin/go-interpreter/evaluator"
+	"github.com/cijin/go-interpreter/lexer"
+	"github.com/cijin/go-interpreter/object"
+	"github.com/cijin/go-interpreter/parser"
+	"github.com/cijin/go-interpreter/vm"
+)
+
+// expected results that aren't plain ints, bools, strings or nil (null)
+type (
+	errorMsg  string // runtime error, compared against the message
+	errorAt   string // runtime error, compared against message & position
+	traceback string // runtime error, compared against its Traceback()
+	inspect   string // compared against Inspect(), for arrays & hashes
+)
+
+type testCase struct {
+	input    string
+	expected interface{}
+}
+
+type engine struct {
+	name string
+	run  func(input string, checked bool) object.Object
+}
+
+var engines = []engine{
+	{"evaluator", runEvaluator},
+	{"vm", runVM},
+}
+
+// checked turns on checked arithmetic
+func runEvaluator(input string, checked bool) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	env := object.NewEnviornment()
+	env.CheckArithmetic(checked)
+
+	return evaluator.Eval(program, env)
+}
+
+// errors from the compiler & vm are handed back as values, the same way
+// the evaluator returns them
+func runVM(input string, checked bool) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.CheckArithmetic(checked)
+	if err := machine.Run(); err != nil {
+		if objErr, ok := err.(*object.Error); ok {
+			return objErr
+		}
+
+		return &object.Error{Message: err.Error()}
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+func runConformanceTests(t *testing.T, tests []testCase) {
+	t.Helper()
+
+	for _, e := range engines {
+		for _, tt := range tests {
+			result := e.run(tt.input, false)
+			checkResult(t, e.name, tt, result)
+		}
+	}
+}
+
+// runCheckedConformanceTests runs the tests with checked arithmetic on
+func runCheckedConformanceTests(t *testing.T, tests []testCase) {
+	t.Helper()
+
+	for _, e := range engines {
+		for _, tt := range tests {
+			result := e.run(tt.input, true)
+			checkResult(t, e.name, tt, result)
+		}
+	}
+}
+
+func checkResult(t *testing.T, engine string, tt testCase, result object.Object) {
+	t.Helper()
+
+	fail := func(format string, a ...interface{}) {
+		t.Helper()
+		t.Errorf("[%s] %q: "+format, append([]interface{}{engine, tt.input}, a...)...)
+	}
+
+	switch expected := tt.expected.(type) {
+	case int:
+		integer, ok := result.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			fail("expected %d, got=%T (%+v)", expected, result, result)
+		}
+
+	case float64:
+		float, ok := result.(*object.Float)
+		if !ok || float.Value != expected {
+			fail("expected %g, got=%T (%+v)", expected, result, result)
+		}
+
+	case bool:
+		boolean, ok := result.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			fail("expected %t, got=%T (%+v)", expected, result, result)
+		}
+
+	case string:
+		str, ok := result.(*object.String)
+		if !ok || str.Value != expected {
+			fail("expected %q, got=%T (%+v)", expected, result, result)
+		}
+
+	case nil:
+		if result != object.NULL {
+			fail("expected null, got=%T (%+v)", result, result)
+		}
+
+	case errorMsg:
+		err, ok := result.(*object.Error)
+		if !ok || err.Message != string(expected) {
+			fail("expected error %q, got=%T (%+v)", expected, result, result)
+		}
+
+	case errorAt:
+		err, ok := result.(*object.Error)
+		if !ok || err.Inspect() != string(expected) {
+			fail("expected error %q, got=%T (%+v)", expected, result, result)
+		}
+
+	case traceback:
+		err, ok := result.(*object.Error)
+		if !ok || err.Traceback() != string(expected) {
+			fail("expected traceback %q, got=%T (%+v)", expected, result, result)
+		}
+
+	case inspect:
+		if result == nil || result.Inspect() != string(expected) {
+			fail("expected %s, got=%T (%+v)", expected, result, result)
+		}
+
+	default:
+		fail("unhandled expected type %T", expected)
+	}
+}
+
+func TestIntegerExpression(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	})
+}
+
+func TestFloatExpression(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"1.5", 1.5},
+		{"1.5e3", 1500.0},
+		{"25E-2", 0.25},
+		{"-2.5", -2.5},
+		{"0.5 + 0.25", 0.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"2 * (1.5 - 1)", 1.0},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"1 != 1.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{`1.5 + "a"`, errorMsg("type mismatch: FLOAT + STRING")},
+		{"true + 1.5", errorMsg("type mismatch: BOOLEAN + FLOAT")},
+		{"1.5 + 1.5", inspect("3.0")},
+		{"1e21 * 10", inspect("1e+22")},
+		{"int(2.9)", 2},
+		{"int(-2.9)", -2},
+		{`int(" 42 ")`, 42},
+		{"int(1.0 / 0)", errorMsg("cannot convert +Inf to INTEGER")},
+		{`int("4.2")`, errorMsg(`cannot convert "4.2" to INTEGER`)},
+		{"int(true)", errorMsg("wrong type of argument 1 for int: want=INTEGER, FLOAT or STRING, got=BOOLEAN")},
+		{"float(2)", 2.0},
+		{`float("1.5e3")`, 1500.0},
+		{`float("one")`, errorMsg(`cannot convert "one" to FLOAT`)},
+		{"float()", errorMsg("wrong number of arguments for float: want=1, got=0")},
+	})
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"1 / 0", errorMsg("division by zero")},
+		{"let f = fn(x) { 10 / x };\nf(0)", errorAt("1:17: division by zero")},
+		{"1.0 / 0", inspect("+Inf")},
+	})
+
+	runCheckedConformanceTests(t, []testCase{
+		{"9223372036854775807 + 1", errorMsg("integer overflow: 9223372036854775807 + 1")},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 2", errorMsg("integer overflow: -9223372036854775807 - 2")},
+		{"4611686018427387904 * 2", errorMsg("integer overflow: 4611686018427387904 * 2")},
+		{"let min = -9223372036854775807 - 1; min / -1", errorMsg("integer overflow: -9223372036854775808 / -1")},
+		{"let min = -9223372036854775807 - 1; -min", errorMsg("integer overflow: -(-9223372036854775808)")},
+		{"let f = fn(x) { x * x }; f(3037000500)", errorAt("1:17: integer overflow: 3037000500 * 3037000500")},
+		{"3037000499 * 3037000499", 9223372030926249001},
+		{"1 / 0", errorMsg("division by zero")},
+	})
+}
+
+func TestBigIntegers(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		// integers that outgrow an int64 turn in to big ones
+		{"9223372036854775807 + 1", inspect("9223372036854775808")},
+		{"-9223372036854775807 - 2", inspect("-9223372036854775809")},
+		{"4611686018427387904 * 2", inspect("9223372036854775808")},
+		{"let min = -9223372036854775807 - 1; -min", inspect("9223372036854775808")},
+		{"let min = -9223372036854775807 - 1; min / -1", inspect("9223372036854775808")},
+		{"123456789012345678901234567890", inspect("123456789012345678901234567890")},
+		{"-123456789012345678901234567890 * 10", inspect("-1234567890123456789012345678900")},
+		// and back in to small ones when they fit again
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"-(-9223372036854775808)", inspect("9223372036854775808")},
+		{"100000000000000000000 / 100000000000000000000", 1},
+		{"-100000000000000000001 / 10", inspect("-10000000000000000000")},
+		{"10 / 100000000000000000000", 0},
+		{"100000000000000000000 / 0", errorMsg("division by zero")},
+		{"100000000000000000000 > 1", true},
+		{"1 < -100000000000000000000", false},
+		{"9223372036854775807 + 1 == 9223372036854775808", true},
+		{"9223372036854775808 - 1 == 9223372036854775807", true},
+		{"100000000000000000000 != 100000000000000000000", false},
+		{"100000000000000000000 * 1.5", 1.5e20},
+		{"100000000000000000000 == 1e20", true},
+		{"100000000000000000000 + true", errorMsg("type mismatch: INTEGER + BOOLEAN")},
+		{`{9223372036854775808 - 1: "max"}[9223372036854775807]`, "max"},
+		{`{100000000000000000000: "big"}[10000000000 * 10000000000]`, "big"},
+		{"[1, 2][100000000000000000000]", nil},
+		{"int(1e20)", inspect("100000000000000000000")},
+		{`int("-100000000000000000000")`, inspect("-100000000000000000000")},
+		{"float(100000000000000000000)", 1e20},
+	})
+
+	runCheckedConformanceTests(t, []testCase{
+		{"100000000000000000000 - 1", errorMsg("integer overflow: 100000000000000000000 - 1")},
+		{"100000000000000000000 / 100000000000000000000", 1},
+		{"-(-9223372036854775808)", errorMsg("integer overflow: -(-9223372036854775808)")},
+	})
+}
+
+func TestStringExpression(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`"hello world"`, "hello world"},
+		{`"hello" + "world";`, "helloworld"},
+		{`"hello" + " "  + "world";`, "hello world"},
+		{`"say \"hi\"\n" + "\u{e9}\x41"`, "say \"hi\"\néA"},
+		{"`multi\nline \\n`", "multi\nline \\n"},
+		{`let name = "monkey"; let n = 2; "Hello ${name}, you have ${n + 1} items"`, "Hello monkey, you have 3 items"},
+		{`"${[1, "a"]} ${ {"k": true}["k"] } ${fn(){}()} ${"in ${1 + 1}"}"`, "[1, a] true null in 2"},
+		{`"\${not} $ {this}"`, "${not} $ {this}"},
+	})
+}
+
+func TestBooleanExpression(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{`"hello" == "world"`, false},
+		{`"hello" == "hello"`, true},
+	})
+}
+
+func TestComparisonOperators(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
+		{"100000000000000000000 >= 100000000000000000000", true},
+		{"1 < 2 == 2 >= 1", true},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 + 7 % 3 * 2", 4},
+		{"7.5 % 2", 1.5},
+		{"100000000000000000007 % 10", 7},
+		{"7 % 0", errorMsg("division by zero")},
+		{"100000000000000000000 % 0", errorMsg("division by zero")},
+		{`"a" <= "b"`, errorMsg("operartor <= not supported on type string")},
+		{"true >= false", errorMsg("unknown operator: BOOLEAN >= BOOLEAN")},
+	})
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~0", -1},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"256 >> 4", 16},
+		{"-16 >> 2", -4},
+		{"-1 >> 100", -1},
+		{"1 >> 100", 0},
+		{"let flags = 0; let flags = flags | 1 << 3; (flags & 8) != 0", true},
+		// like in c, comparisons bind tighter than & does
+		{"6 & 2 == 2", errorMsg("type mismatch: INTEGER & BOOLEAN")},
+		{"1 | 2 ^ 3 & 4", 3},
+		// left shifts grow in to big integers
+		{"1 << 64", inspect("18446744073709551616")},
+		{"-1 << 63", -9223372036854775808},
+		{"(1 << 100) >> 99", 2},
+		{"(1 << 100) & (1 << 100 | 1)", inspect("1267650600228229401496703205376")},
+		{"~(1 << 64)", inspect("-18446744073709551617")},
+		{"-(1 << 80) >> 1000", -1},
+		{"1 << -1", errorMsg("negative shift count: -1")},
+		{"1 >> -1", errorMsg("negative shift count: -1")},
+		{"(1 << 64) >> -1", errorMsg("negative shift count: -1")},
+		{"1 << 100000000000000000000", errorMsg("shift count too large: 100000000000000000000")},
+		{"1 >> 100000000000000000000", 0},
+		{"1.5 & 1", errorMsg("type mismatch: FLOAT & INTEGER")},
+		{"1.5 | 2.5", errorMsg("unknown operator: FLOAT | FLOAT")},
+		{"~1.5", errorMsg("operator '~' not defined on FLOAT")},
+		{"~true", errorMsg("operator '~' not defined on BOOLEAN")},
+		{`"a" & "b"`, errorMsg("operartor & not supported on type string")},
+	})
+
+	runCheckedConformanceTests(t, []testCase{
+		{"1 << 62", 4611686018427387904},
+		{"1 << 63", errorMsg("integer overflow: 1 << 63")},
+	})
+}
+
+func TestLogicalOperators(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		// operands are truthy or not the same way conditions are
+		{"1 && \"\"", true},
+		{"if (false) { 1 } && 1", false},
+		{"0 || if (false) { 1 }", true},
+		{"if (false) { 1 } || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"true || false && false", true},
+		{"!true || true", true},
+		// the right hand side is only evaluated when it is needed
+		{"false && 1 / 0", false},
+		{"true || missing", true},
+		{"true && 1 / 0", errorMsg("division by zero")},
+		{"false || missing", errorMsg("identifier is undefined: missing")},
+	})
+}
+
+func TestBangPrefixExpressions(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	})
+}
+
+func TestIfExpressions(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"if (true) { let x = 5; }", nil},
+	})
+}
+
+func TestReturnStatements(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"return 10", 10},
+		{"return 10; 9", 10},
+		{"9;return 10; 9", 10},
+		{"return 2 * 5; 9", 10},
+		{"9;return 2 * 5; 9", 10},
+		{`
+			if (10 > 1) {
+				if (10 > 1) {
+					return 10
+				}
+
+				return 2
+			}
+		`, 10},
+	})
+}
+
+func TestAssignment(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 2; x = y = 3; x + y", 6},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let x = 1.5; x *= 2; x", 3.0},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"x = 1", errorAt("1:1: identifier is undefined: x")},
+		{"x += 1", errorMsg("identifier is undefined: x")},
+		{"len = 1", errorAt("1:1: cannot assign to builtin len")},
+		{`let x = 1; x += "a"`, errorMsg("type mismatch: INTEGER + STRING")},
+		// assignments update the binding they find, rather than making one
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 2 }; f(); x", 1},
+		{"let f = fn() { x = 2 }; let x = 1; f(); x", 2},
+		{"let f = fn() { f = 1 }; f(); f", 1},
+		// closures share the variables they capture
+		{`
+			let counter = fn() {
+				let n = 0;
+				fn() { n += 1 }
+			};
+			let c = counter();
+			c(); c();
+			c()
+		`, 3},
+		{`
+			let f = fn() {
+				let n = 0;
+				let inc = fn() { n += 1 };
+				let get = fn() { n };
+				inc(); inc();
+				[n, get()]
+			};
+			f()
+		`, inspect("[2, 2]")},
+		{`
+			let f = fn(n) {
+				let g = fn() { fn() { n = n * 10 } };
+				g()();
+				n
+			};
+			f(4)
+		`, 40},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i }; sum", 15},
+	})
+}
+
+func TestCheckedAssignment(t *testing.T) {
+	runCheckedConformanceTests(t, []testCase{
+		{"let x = 9223372036854775807; x += 1", errorMsg("integer overflow: 9223372036854775807 + 1")},
+	})
+}
+
+func TestConstStatement(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"const x = 5; x", 5},
+		{"const xs = [1]; xs[0] = 2; xs", inspect("[2]")},
+		{"const f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3)", 0},
+		{"const x = 5;\nx = 6", errorAt("2:1: cannot assign to const x (declared at 1:1)")},
+		{"const x = 5; x += 1", errorAt("1:14: cannot assign to const x (declared at 1:1)")},
+		{"let a = 1;\n  const x = 5;\nlet x = 6", errorAt("3:1: cannot redeclare const x (declared at 2:3)")},
+		{"const x = 5; const x = 6", errorAt("1:14: cannot redeclare const x (declared at 1:1)")},
+		{"const x = 5; for (x in [1]) { }", errorAt("1:14: cannot redeclare const x (declared at 1:1)")},
+		{"const x = 5; let f = fn() { x = 6 }; f()", errorAt("1:29: cannot assign to const x (declared at 1:1)")},
+		{"let f = fn() { x = 6 }; const x = 5; f()", errorAt("1:16: cannot assign to const x (declared at 1:25)")},
+		{"let f = fn() { const y = 1; let g = fn() { y = 2 }; g() }; f()", errorAt("1:44: cannot assign to const y (declared at 1:16)")},
+		// NameErrors raised as the assignment runs, which scripts can catch
+		{"const x = 5; let f = fn() { x = 6 }; f()", traceback("1:29: NameError: cannot assign to const x (declared at 1:1)\n\tin f, called at 1:38")},
+		{`const x = 5; let r = 0; try { x = 6 } catch (e) { r = e["kind"] + ": " + e["message"] }; r`, "NameError: cannot assign to const x (declared at 1:1)"},
+		{`const x = 5; let r = 0; try { let x = 6 } catch (e) { r = e["kind"] + ": " + e["message"] }; r`, "NameError: cannot redeclare const x (declared at 1:1)"},
+		{"const x = 5; if (false) { x = 6; let x = 7; }; x", 5},
+		// functions have their own scope, where constants can be shadowed
+		{"const x = 5; let f = fn() { let x = 6; x = 7; x }; [f(), x]", inspect("[7, 5]")},
+		{"const x = 5; let f = fn(x) { x += 1 }; f(1)", 2},
+		{"let x = 1; const x = 2; x", 2},
+	})
+}
+
+func TestIndexAssignment(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let xs = [1, 2, 3]; xs[0] = 5; xs", inspect("[5, 2, 3]")},
+		{"let xs = [1, 2, 3]; xs[-1] += 10; xs", inspect("[1, 2, 13]")},
+		{"let xs = [1, 2, 3]; xs[1] = 7", 7},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] *= 5; h`, inspect("{a: 5, b: 2}")},
+		{"let xs = [[1], [2]]; xs[1][0] = 3; xs", inspect("[[1], [3]]")},
+		// arrays & hashes are changed in place
+		{"let xs = [1]; let ys = xs; ys[0] = 2; xs[0]", 2},
+		{"let xs = [1]; let f = fn(a) { a[0] = 9 }; f(xs); xs", inspect("[9]")},
+		{"let xs = [1]; let ys = push(xs, 2); ys[0] = 5; xs", inspect("[1]")},
+		// collections put inside themselves print where they repeat as [...] & {...}
+		{"let a = [0]; a[0] = a; a", inspect("[[...]]")},
+		{`let h = {}; h["self"] = h; h["a"] = [h]; "${h}"`, "{self: {...}, a: [{...}]}"},
+		{"let b = [1]; [b, b]", inspect("[[1], [1]]")},
+		{"let xs = [1, 2]; xs[2] = 3", errorAt("1:18: index out of range: 2")},
+		{"let xs = [1, 2]; xs[-3] = 3", errorMsg("index out of range: -3")},
+		{`let s = "abc"; s[0] = "x"`, errorMsg("index assignment not supported: STRING[INTEGER]")},
+		{"let h = {}; h[fn() {}] = 1", errorMsg("unusable as hash key: FUNCTION")},
+		{`let h = {}; h["a"] += 1`, errorMsg("type mismatch: NULL + INTEGER")},
+		{`
+			let squares = [0, 0, 0, 0];
+			let i = 0;
+			for (x in squares) {
+				squares[i] = i * i;
+				i += 1
+			}
+			squares
+		`, inspect("[0, 1, 4, 9]")},
+	})
+}
+
+func TestNull(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"null", nil},
+		{"let x = null; x", nil},
+		{"null == null", true},
+		{"null != 1", true},
+		{`"" == null`, false},
+		{"let h = {}; h[1] == null", true},
+		{"null < 1", errorMsg("type mismatch: NULL < INTEGER")},
+		// null is falsy, the same as false
+		{"!null", true},
+		{"if (null) { 1 } else { 2 }", 2},
+		{"null || 1", true},
+		{"null && 1", false},
+		{"null + 1", errorMsg("type mismatch: NULL + INTEGER")},
+	})
+}
+
+func TestNullCoalescing(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"null ?? 1", 1},
+		{"2 ?? 1", 2},
+		// only null counts as missing, falsy values are kept
+		{"false ?? 1", false},
+		{`"" ?? 1`, ""},
+		{"null ?? null ?? 3", 3},
+		{"null ?? false || true", true},
+		{`{"a": 1}["b"] ?? 0`, 0},
+		{"[][0] ?? 5", 5},
+		// the right hand side is only evaluated when needed
+		{"1 ?? undefined", 1},
+		{"null ?? undefined", errorMsg("identifier is undefined: undefined")},
+	})
+}
+
+func TestOptionalAccess(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`let h = {"name": "monkey"}; h?.name`, "monkey"},
+		{`let h = {"name": "monkey"}; h?.age`, nil},
+		{`let h = {"a": {"b": 2}}; h?.a?.b`, 2},
+		{`let h = {"a": null}; h?.a?.b`, nil},
+		{`let h = {"a": null}; h?.a?["b"]`, nil},
+		{"let xs = [1, 2]; xs?[1]", 2},
+		{"let xs = null; xs?[0]", nil},
+		{`null?.name ?? "unknown"`, "unknown"},
+		{"[[1], null][1]?[0]", nil},
+		// the index isn't evaluated when the left hand side is null
+		{"null?[undefined]", nil},
+		{"1?[0]", errorMsg("index operator not supported: INTEGER[INTEGER]")},
+		{"[1]?.name", errorMsg("index operator not supported: ARRAY[STRING]")},
+		{`let h = {"a": null}; h?.a["b"]`, errorMsg("index operator not supported: NULL[STRING]")},
+	})
+}
+
+func TestWhileLoops(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let i = 0; while (i < 5) { let i = i + 1 }; i", 5},
+		{"let i = 0; while (false) { let i = i + 1 }; i", 0},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break } }; i", 3},
+		{`
+			let i = 0;
+			let odd = [];
+			while (i < 6) {
+				let i = i + 1;
+				if (i % 2 == 0) { continue; }
+				let odd = push(odd, i);
+			}
+			odd
+		`, inspect("[1, 3, 5]")},
+		{`
+			let f = fn(n) {
+				let i = 0;
+				while (true) {
+					if (i * i >= n) { return i }
+					let i = i + 1
+				}
+			};
+			f(50)
+		`, 8},
+		{"let f = fn() { while (false) { } }; f()", nil},
+		{"if (true) { while (false) { } }", nil},
+		{"while (1 + true) { }", errorMsg("type mismatch: INTEGER + BOOLEAN")},
+	})
+}
+
+func TestForLoops(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x }; sum", 6},
+		{"let s = \"\"; for (c in \"abc\") { let s = c + s }; s", "cba"},
+		// a byte at a time, like indexing, multibyte characters included
+		{`let n = 0; for (c in "é!") { n += len(c) }; n`, 3},
+		{`let s = ""; for (c in "é!") { s += c }; s`, "é!"},
+		{`let ks = ""; for (k in {"a": 1, "b": 2}) { let ks = ks + k }; ks`, "ab"},
+		{"let n = 0; for (x in []) { let n = n + 1 }; n", 0},
+		{"for (x in [1, 2, 3]) { }; x", 3},
+		{`
+			let pairs = [];
+			for (x in [1, 2, 3]) {
+				for (y in [1, 2, 3]) {
+					if (y > x) { break }
+					if (y == 2) { continue }
+					let pairs = push(pairs, [x, y]);
+				}
+			}
+			pairs
+		`, inspect("[[1, 1], [2, 1], [3, 1], [3, 3]]")},
+		{`
+			let find = fn(xs, want) {
+				for (x in xs) {
+					if (x == want) { return true }
+				}
+				false
+			};
+			[find([1, 2, 3], 2), find([1, 2, 3], 4)]
+		`, inspect("[true, false]")},
+		{"for (x in 5) { }", errorMsg("cannot iterate over INTEGER")},
+		{"for (x in [1, 2]) {\n  x + true\n}", errorAt("2:3: type mismatch: INTEGER + BOOLEAN")},
+	})
+}
+
+func TestErrorHandling(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"true + 5", errorMsg("type mismatch: BOOLEAN + INTEGER")},
+		{"5 + true; 5;", errorMsg("type mismatch: INTEGER + BOOLEAN")},
+		{"-true", errorMsg("operator '-' not defined on BOOLEAN")},
+		{"true + false", errorMsg("unknown operator: BOOLEAN + BOOLEAN")},
+		{"5; true + false; 5", errorMsg("unknown operator: BOOLEAN + BOOLEAN")},
+		{"if (10 > 1) { true + false; }", errorMsg("unknown operator: BOOLEAN + BOOLEAN")},
+		{`
+			if (10 > 1) {
+				if (10 > 1) {
+					return true + false;
+				}
+
+				return 1;
+			}
+		`, errorMsg("unknown operator: BOOLEAN + BOOLEAN")},
+		{"foobar", errorMsg("identifier is undefined: foobar")},
+		{`"hello" - "world"`, errorMsg("operartor - not supported on type string")},
+		{`[1, 2][true]`, errorMsg("index operator not supported: ARRAY[BOOLEAN]")},
+		{`1[0]`, errorMsg("index operator not supported: INTEGER[INTEGER]")},
+		{`{"name": "monkey"}[fn(x) { x }];`, errorMsg("unusable as hash key: FUNCTION")},
+		{`{fn(x) { x }: 1};`, errorMsg("unusable as hash key: FUNCTION")},
+	})
+}
+
+func TestTracebacks(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"1 + true", traceback("1:1: TypeError: type mismatch: INTEGER + BOOLEAN")},
+		{"[1][2] = 3", traceback("1:1: IndexError: index out of range: 2")},
+		{"x", traceback("1:1: NameError: identifier is undefined: x")},
+		{"len()", traceback("1:1: ArgumentError: wrong number of arguments for len: want=1, got=0")},
+		{"fn(a) { a }()", traceback("1:1: ArgumentError: wrong number of arguments: want=1, got=0")},
+		{
+			"let div = fn(a, b) {\n  a / b\n};\nlet half = fn(x) { div(x, 2) + div(x, 0) };\nhalf(4)",
+			traceback("2:3: ArithmeticError: division by zero\n\tin div, called at 4:32\n\tin half, called at 5:1"),
+		},
+		// frames of a function that isn't bound by let or const have no name
+		{
+			"let apply = fn(f) { f() };\napply(fn() { -true })",
+			traceback("2:14: TypeError: operator '-' not defined on BOOLEAN\n\tin anonymous function, called at 1:21\n\tin apply, called at 2:1"),
+		},
+		{
+			"let count = fn(n) { if (n == 0) { n + null } else { count(n - 1) } };\ncount(3)",
+			traceback("1:35: TypeError: type mismatch: INTEGER + NULL\n\tin count, called at 1:53\n\t... repeated 2 more times\n\tin count, called at 2:1"),
+		},
+		// functions keep the name they were first bound to
+		{"let f = fn() { 1 + true }; let g = f; g()", traceback("1:16: TypeError: type mismatch: INTEGER + BOOLEAN\n\tin f, called at 1:39")},
+	})
+}
+
+// runaway recursion is an error rather than a crash, and one scripts can catch
+func TestStackOverflow(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let f = fn() { f() }; f()", errorAt("1:16: stack overflow")},
+		{"let f = fn(n) { n + f(n + 1) }; f(0)", errorMsg("stack overflow")},
+		{"let f = fn() { f() }; let g = fn() { try { f() } catch (e) { return e[\"message\"] } }; g()", "stack overflow"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1000)", 1000},
+		{"let f = fn(n) { let a = n; let b = [a, a]; if (n == 0) { 0 } else { b[0] - a + 1 + f(n - 1) } }; f(1000)", 1000},
+	})
+}
+
+func TestThrow(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`throw "boom"`, traceback("1:1: Error: boom")},
+		{"let x = 1;\nthrow [x]", traceback("2:1: Error: [1]")},
+		{`throw {"kind": "ValueError", "message": "bad"}`, traceback("1:1: ValueError: bad")},
+		{"1 + fn() { throw 2 }()", errorMsg("2")},
+		{"let f = fn() { throw null };\nf()", traceback("1:16: Error: null\n\tin f, called at 2:1")},
+		{"throw 1 / 0", errorMsg("division by zero")},
+	})
+}
+
+func TestTryCatch(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`let r = 0; try { 1 / 0 } catch (e) { r = e["kind"] + ": " + e["message"] }; r`, "ArithmeticError: division by zero"},
+		{`let r = 0; try { x } catch (e) { r = e?.kind }; r`, "NameError"},
+		{`let r = 0; try { throw "boom" } catch (e) { r = e }; r`, "boom"},
+		{"let r = 0; let h = {}; try { throw h } catch (e) { r = e == h }; r", true},
+		{"let r = 0; try { throw null } catch (e) { r = e == null }; r", true},
+		{"let r = 0; try { r = 1 } catch (e) { r = 2 }; r", 1},
+		// a try statement has no value of its own
+		{"let f = fn() { try { 1 } catch (e) { 2 } }; f()", nil},
+		{"let f = fn(x) { if (x) { try { throw 1 } catch (e) { return e } } }; [f(true), f(false)]", inspect("[1, null]")},
+		{"let g = fn(e) { fn() { try { e } catch (e) { 0 } } }; g(7)()", nil},
+		{"let v = if (true) { try { throw 1 } catch (e) { 2 } }; v", nil},
+		{"let v = if (true) { try { 1 } finally { 2 } }; v", nil},
+		{"let g = fn(e) { fn() { let r = 0; try { r = e } catch (e) { }; r } }; g(7)()", 7},
+		// the caught error stays bound after the try statement, like a for loop variable
+		{"try { throw 3 } catch (e) { }; e", 3},
+		{"let r = 0; try { r = 1 + [1, 2, fn() { throw 5 }()][0] } catch (e) { r = e }; r", 5},
+		{"let n = 0; for (x in [1, 0, 2, 0]) { try { 10 / x } catch (e) { n += 1 } }; n", 2},
+		{"let f = fn(x) { try { 10 / x } catch (e) { return -1 }; 1 }; [f(0), f(5)]", inspect("[-1, 1]")},
+		{"let f = fn() { 1 / 0 }; let r = 0; try { f() } catch (e) { r = e[\"kind\"] }; r", "ArithmeticError"},
+		{"let r = 0; try { try { 1 / 0 } catch (e) { throw e } } catch (e) { r = e[\"message\"] }; r", "division by zero"},
+		{"try { 1 / 0 } catch (e) { throw e }", traceback("1:27: ArithmeticError: division by zero")},
+		{"try { 1 / 0 } catch (e) { y }", traceback("1:27: NameError: identifier is undefined: y")},
+		{"const e = 1; try { } catch (e) { }", errorAt("1:14: cannot redeclare const e (declared at 1:1)")},
+		// only limits set by the host are out of reach of catch
+		{"let f = fn() { try { throw {\"kind\": \"LimitError\"} } catch (e) { return e[\"kind\"] } }; f()", "LimitError"},
+	})
+}
+
+func TestTryFinally(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let n = 0; try { n = 1 } finally { n += 10 }; n", 11},
+		{"let n = 0; try { n = 1 } catch (e) { n = 2 } finally { n += 10 }; n", 11},
+		{"let n = 0; try { 1 / 0 } catch (e) { n = 2 } finally { n += 10 }; n", 12},
+		// the error carries on once the finally block is done
+		{"let n = 0; let f = fn() { try { 1 / 0 } finally { n = 1 } }; try { f() } catch (e) { n += 10 }; n", 11},
+		{"let n = 0; try { try { 1 / 0 } catch (e) { x } finally { n = 1 } } catch (e) { n = [n, e[\"kind\"]] }; n", inspect("[1, NameError]")},
+		{"let f = fn() { 1 / 0 };\nlet g = fn() { try { f() } finally { 1 } };\ng()", traceback("1:16: ArithmeticError: division by zero\n\tin f, called at 2:22\n\tin g, called at 3:1")},
+		// returns run the finally block on the way out
+		{"let n = 0; let f = fn() { try { return 1 } finally { n = 5 } }; f() + n", 6},
+		{"let n = 0; let f = fn() { try { return 1 } catch (e) { } finally { n = 5 } }; f() + n", 6},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let f = fn() { try { 1 / 0 } finally { return 3 } }; f()", 3},
+		{"let f = fn() { try { throw 1 } catch (e) { return e + 1 } finally { 10 } }; f()", 2},
+		{"let n = 0; let f = fn() { try { try { return 1 } finally { n = n * 10 + 1 } } finally { n = n * 10 + 2 } }; [f(), n]", inspect("[1, 12]")},
+		// so do breaks & continues
+		{"let total = 0; for (i in [1, 2, 3, 4]) { try { if (i == 2) { continue }; if (i == 4) { break }; total += i } finally { total += 10 } }; total", 44},
+		{"let n = 0; while (true) { try { while (true) { break } ; n += 1; break } finally { n += 10 } }; n", 11},
+		{"let f = fn() { let i = 0; while (true) { try { return i } finally { i += 1; if (i < 3) { continue } } } }; f()", 2},
+		{"const c = 1; let f = fn() { try { return 1 } finally { const c = 2 } }; [f(), c]", inspect("[1, 1]")},
+	})
+}
+
+func TestErrorPositions(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"5 + true", errorAt("1:1: type mismatch: INTEGER + BOOLEAN")},
+		{"let x = 1;\n  -true", errorAt("2:3: operator '-' not defined on BOOLEAN")},
+		{"let f = fn() {\n  foobar\n};\nf()", errorAt("2:3: identifier is undefined: foobar")},
+		{`len(1, 2)`, errorAt("1:1: wrong number of arguments for len: want=1, got=2")},
+		{"[1, 2][\"a\"]", errorAt("1:1: index operator not supported: ARRAY[STRING]")},
+	})
+}
+
+func TestLetStatement(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let x = 5;x;", 5},
+		{"let x = 5 * 5;x;", 25},
+		{"let x = 5; let y = x;y;", 5},
+		{"let x = 5; let y = x; let z = x + y + 5;z;", 15},
+	})
+}
+
+func TestFunctionCall(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let x = fn(y) { y }; x(5);", 5},
+		{"let x = fn(y) { return y }; x(5);", 5},
+		{"let double = fn(x) { return x * 2 }; double(5);", 10},
+		{"let add = fn(x, y) { return x + y }; add(5, 5);", 10},
+		{"let add = fn(x, y) { return x + y }; add(5, add(5, 5));", 15},
+		{"fn(x, y) { return x + y }(5, 5);", 10},
+		{"fn() { }()", nil},
+		{"fn() { let x = 5; }()", nil},
+		{"let f = fn() { }; let x = f(); x", nil},
+		{"fn(x) { x }();", errorMsg("wrong number of arguments: want=1, got=0")},
+		{"fn() { 1 }(1);", errorMsg("wrong number of arguments: want=0, got=1")},
+		{"fn(a, b) { a + b }(1);", errorMsg("wrong number of arguments: want=2, got=1")},
+		{"let f = fn() { g() }; let g = fn() { 3 }; f()", 3},
+	})
+}
+
+func TestClosures(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`
+			let x = 10;
+			let y = 10;
+
+			let addTwo = fn(x) {
+				return fn(y) {
+					return x + y;
+				};
+			};
+
+			let add = addTwo(2);
+			add(4);
+		`, 6},
+		{`
+			let fib = fn(n) {
+				if (n < 2) { return n }
+				fib(n - 1) + fib(n - 2)
+			};
+			fib(15);
+		`, 610},
+		{`
+			let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0 }
+					countDown(x - 1)
+				};
+				countDown(3);
+			};
+			wrapper();
+		`, 0},
+	})
+}
+
+func TestNestedScopes(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"let x = 1; let f = fn() { fn() { fn() { fn() { x } } } }; f()()()();", 1},
+		{"let add = fn(a) { fn(b) { fn(c) { fn(d) { a + b + c + d } } } }; add(1)(2)(3)(4);", 10},
+		{"let f = fn() { fn() { fn() { len([1, 2, 3]) } } }; f()()();", 3},
+		{`
+		let outer = fn(n) {
+			let countDown = fn(x) {
+				if (x == 0) { return n; }
+				countDown(x - 1);
+			};
+			fn() { countDown(5) };
+		};
+		outer(7)();
+		`, 7},
+		{"let x = 1; let f = fn() { let x = 2; fn() { let x = 3; fn() { x } } }; f()()();", 3},
+		{"let x = 1; let f = fn() { let x = 2; fn() { fn() { x } } }; f()()();", 2},
+		{"let x = 1; let f = fn(x) { x * 10 }; f(5) + x;", 51},
+		{"let f = fn() { let len = fn(x) { 42 }; fn() { len([]) } }; f()();", 42},
+	})
+}
+
+func TestBuiltinFunction(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`len("hello")`, 5},
+		{`len("hello world")`, 11},
+		{`len("1")`, 1},
+		{`len("")`, 0},
+		{`len(1)`, errorMsg("wrong type of argument 1 for len: want=STRING, ARRAY or HASH, got=INTEGER")},
+		{`len("one", "two")`, errorMsg("wrong number of arguments for len: want=1, got=2")},
+		{`len()`, errorMsg("wrong number of arguments for len: want=1, got=0")},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first("abc")`, "a"},
+		{`first(1)`, errorMsg("wrong type of argument 1 for first: want=STRING or ARRAY, got=INTEGER")},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last("abc")`, "c"},
+		{`rest([1, 2, 3])`, inspect("[2, 3]")},
+		{`rest([1])`, inspect("[]")},
+		{`rest([])`, nil},
+		{`rest("abc")`, "bc"},
+		{`push([], 1)`, inspect("[1]")},
+		{`push([1, 2], 3)`, inspect("[1, 2, 3]")},
+		{`push("ab", "c")`, "abc"},
+		{`push("ab", 1)`, errorMsg("wrong type of argument 2 for push: want=STRING, got=INTEGER")},
+		{`push(1, 1)`, errorMsg("wrong type of argument 1 for push: want=STRING or ARRAY, got=INTEGER")},
+		{`let a = [1]; let b = push(a, 2); len(a)`, 1},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`keys({"a": 1, "b": 2})`, inspect("[a, b]")},
+		{`keys({})`, inspect("[]")},
+		{`values({"a": 1, "b": 2})`, inspect("[1, 2]")},
+		{`keys(1)`, errorMsg("wrong type of argument 1 for keys: want=HASH, got=INTEGER")},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": 1}, fn(x) { x })`, errorMsg("unusable as hash key: FUNCTION")},
+		{`keys(delete({"a": 1, "b": 2}, "a"))`, inspect("[b]")},
+		{`let h = {"a": 1}; delete(h, "a"); len(h)`, 1},
+		{`delete({"a": 1}, "b")["a"]`, 1},
+	})
+}
+
+// scripts run with a registry of their own see only its builtins, on both
+// engines
+func TestBuiltinRegistry(t *testing.T) {
+	registry := object.NewBuiltinRegistry()
+	registry.Register("len", nil, func(args ...object.Object) object.Object {
+		return &object.String{Value: "stubbed"}
+	})
+	registry.Register("strings.upper", nil, func(args ...object.Object) object.Object {
+		return &object.String{Value: strings.ToUpper(args[0].Inspect())}
+	})
+
+	tests := []testCase{
+		{`len("abc")`, "stubbed"},
+		{`first([1])`, traceback("1:1: NameError: identifier is undefined: first")},
+		{`strings["upper"]("abc")`, "ABC"},
+		{`let s = strings; s["upper"] = 1; strings["upper"]("abc")`, "ABC"},
+		{`let strings = 1; strings`, 1},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		env := object.NewEnviornment()
+		env.SetBuiltins(registry)
+		checkResult(t, "evaluator", tt, evaluator.Eval(program, env))
+
+		comp := compiler.NewWithBuiltins(registry)
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("[vm] %q: compile error %s", tt.input, err)
+		}
+
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			checkResult(t, "vm", tt, err.(*object.Error))
+			continue
+		}
+		checkResult(t, "vm", tt, machine.LastPoppedStackElem())
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"[1, 2 * 2, 3 + 3]", inspect("[1, 4, 6]")},
+		{"[]", inspect("[]")},
+	})
+}
+
+func TestIndexExpressions(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][0]", nil},
+		{`"abc"[1]`, "b"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[3]`, nil},
+	})
+}
+
+func TestHashLiteral(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`let two = "two";
+		{
+			"one": 10 - 9,
+			two: 1 + 1,
+			"thr" + "ee": 6 / 2,
+			4: 4,
+			true: 5,
+			false: 6
+		}`, inspect("{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}")},
+		{`{}`, inspect("{}")},
+	})
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	runConformanceTests(t, []testCase{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	})
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	input := `
+	let fib = fn(n) {
+		if (n < 2) { return n }
+		fib(n - 1) + fib(n - 2)
+	};
+	fib(20);
+	`
+
+	for _, e := range engines {
+		b.Run(e.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				e.run(input, false)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// lines of unchanged context around each hunk of a diff
+const diffContext = 3
+
+type edit struct {
+	op   byte // ' ', '-' or '+'
+	line string
+}
+
+/*
+diff returns a unified diff between a and b, or nothing if they are equal.
+It finds the longest common subsequence of lines, which is quadratic but
+plenty fast for scripts.
+*/
+func diff(name string, a, b []byte) []byte {
+	edits := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	var out bytes.Buffer
+
+	// line numbers in a and b before each edit
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.op != '+' {
+			aLine[i+1] += 1
+		}
+		if e.op != '-' {
+			bLine[i+1] += 1
+		}
+	}
+
+	for i := 0; i < len(edits); i++ {
+		if edits[i].op == ' ' {
+			continue
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", name, name)
+		}
+
+		// extend the hunk while changes are close enough to share context
+		last := i
+		for j := i; j < len(edits) && j-last <= 2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				last = j
+			}
+		}
+
+		start := max(i-diffContext, 0)
+		end := min(last+diffContext+1, len(edits))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end - 1
+	}
+
+	return out.Bytes()
+}
+
+// hunkRange formats the start and length of a hunk, an empty range points
+// at the line before it
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// splitLines keeps the newlines, so a missing one at the end shows up
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func diffLines(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i += 1
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j += 1
+		}
+	}
+
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+
+	return edits
+}
@@ -2,6 +2,8 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/cijin/go-interpreter/ast"
 	"github.com/cijin/go-interpreter/object"
@@ -9,41 +11,31 @@ import (
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return &object.Error{Message: fmt.Sprintf("too many args for len, expected=1, got=%d", len(args))}
-			}
-
-			switch a := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(a.Value))}
-
-			default:
-				return &object.Error{Message: fmt.Sprintf("invalid arg type for len, expected=STRING, got=%s", a.Type())}
-			}
-		},
-	},
-}
-
-func newErrorf(format string, a ...interface{}) *object.Error {
+func newErrorf(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
 	return &object.Error{
+		Kind:    kind,
 		Message: fmt.Sprintf(format, a...),
 	}
 }
 
+// break & continue count as errors here, they abandon whatever expression
+// they are in until the loop around them picks them up
 func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+	if obj == nil {
+		return false
 	}
 
-	return false
+	switch obj.Type() {
+	case object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	default:
+		return false
+	}
 }
 
 func evalProgram(stmts []ast.Statement, env *object.Enviornment) object.Object {
@@ -81,7 +73,7 @@ func evalBlockStatements(stmts []ast.Statement, env *object.Enviornment) object.
 		result = Eval(stmt, env)
 
 		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+			if result.Type() == object.RETURN_VALUE_OBJ || isError(result) {
 				return result
 			}
 		}
@@ -90,6 +82,142 @@ func evalBlockStatements(stmts []ast.Statement, env *object.Enviornment) object.
 	return result
 }
 
+// loops are statements, they have no value of their own so a loop that
+// runs to the end evaluates to nil like a let statement does
+func evalWhileStatement(n *ast.WhileStatement, env *object.Enviornment) object.Object {
+	for {
+		if err := env.Usage().Interrupted(); err != nil {
+			return err
+		}
+
+		condition := Eval(n.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		result := Eval(n.Body, env)
+		if done, result := loopSignal(result); done {
+			return result
+		}
+	}
+}
+
+/*
+ * evalTryStatement runs the finally block however the try & catch blocks
+ * are left, be it at their end, by an error, a return, a break or a
+ * continue. What left them carries on afterwards, unless the finally block
+ * is left early itself. Like loops, a try statement has no value.
+ */
+func evalTryStatement(n *ast.TryStatement, env *object.Enviornment) object.Object {
+	if n.Catch != nil {
+		if err := checkRedeclaration(n.Param.Value, n.Pos(), env); err != nil {
+			return err
+		}
+	}
+
+	result := Eval(n.Body, env)
+
+	// a script can't carry on past its limits, though it can throw errors
+	// of the same kind
+	if err, ok := result.(*object.Error); ok && n.Catch != nil && (err.Kind != object.LIMIT_ERROR || err.Value != nil) {
+		result = evalCatch(n, err, env)
+	}
+
+	if n.Finally != nil {
+		if final := Eval(n.Finally, env); leftEarly(final) {
+			return final
+		}
+	}
+
+	if leftEarly(result) {
+		return result
+	}
+
+	return nil
+}
+
+// the caught error is bound in the scope the try statement is in, like
+// the variable of a for loop
+func evalCatch(n *ast.TryStatement, err *object.Error, env *object.Enviornment) object.Object {
+	env.Set(n.Param.Value, err.Caught())
+
+	return Eval(n.Catch, env)
+}
+
+// leftEarly reports whether a block was left before its end
+func leftEarly(obj object.Object) bool {
+	return obj != nil && (isError(obj) || obj.Type() == object.RETURN_VALUE_OBJ)
+}
+
+// the loop variable is bound in the scope the loop is in, like a let
+func evalForStatement(n *ast.ForStatement, env *object.Enviornment) object.Object {
+	if err := checkRedeclaration(n.Variable.Value, n.Pos(), env); err != nil {
+		return err
+	}
+
+	iterable := Eval(n.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	iterator, ok := object.NewIterator(iterable)
+	if !ok {
+		return newErrorf(object.TYPE_ERROR, "cannot iterate over %s", iterable.Type())
+	}
+
+	for {
+		if err := env.Usage().Interrupted(); err != nil {
+			return err
+		}
+
+		item, ok := iterator.Next()
+		if !ok {
+			return nil
+		}
+
+		env.Set(n.Variable.Value, item)
+
+		result := Eval(n.Body, env)
+		if done, result := loopSignal(result); done {
+			return result
+		}
+	}
+}
+
+// checkRedeclaration stops name being bound again in a scope that has it as
+// a constant, by let, const, a for loop or a catch. A const statement that
+// runs again, in a loop say, only declares the same constant again.
+func checkRedeclaration(name string, pos token.Position, env *object.Enviornment) *object.Error {
+	if declared, ok := env.Const(name, false); ok && declared != pos {
+		return newErrorf(object.NAME_ERROR, "cannot redeclare const %s (declared at %s)", name, declared)
+	}
+
+	return nil
+}
+
+// loopSignal reports whether the result of a loop body ends the loop, and
+// what the loop itself should give back if so
+func loopSignal(result object.Object) (bool, object.Object) {
+	if result == nil {
+		return false, nil
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return true, nil
+	case object.CONTINUE_OBJ:
+		return false, nil
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return true, result
+	default:
+		return false, nil
+	}
+}
+
 func nativeBoolToBooleanObject(v bool) object.Object {
 	if v {
 		return TRUE
@@ -114,53 +242,133 @@ func evalBangPrefixExpressionOperator(operand object.Object) object.Object {
 	}
 }
 
-func evalMinusPrefixExpressionOperator(operand object.Object) object.Object {
-	if operand.Type() != object.INTEGER_OBJ {
-		return newErrorf("operator '-' not defined on %s", operand.Type())
-	}
-
-	value := operand.(*object.Integer).Value
-	return &object.Integer{Value: -value}
-}
-
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, checked bool) object.Object {
 	switch operator {
 	case token.MINUS:
-		return evalMinusPrefixExpressionOperator(right)
+		return object.Negate(right, checked)
+
+	case token.BIT_NOT:
+		return object.BitNot(right)
 
 	case token.BANG:
 		return evalBangPrefixExpressionOperator(right)
 
 	default:
-		return newErrorf("unknown operator: %s", operator)
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s", operator)
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+/*
+evalIntegerInfixExpression works on int64s as long as the result fits, and
+switches to big integers when it doesn't. With checked set a result that
+doesn't fit is an error instead. Dividing by zero is always an error.
+*/
+func evalIntegerInfixExpression(operator string, left, right object.Object, checked bool) object.Object {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if !lok || !rok {
+		return object.BigIntInfix(operator, left, right, checked)
+	}
+
+	leftValue, rightValue := l.Value, r.Value
+
+	var (
+		value int64
+		ok    bool
+	)
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
+		value, ok = object.AddInt64(leftValue, rightValue)
 	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
+		value, ok = object.SubInt64(leftValue, rightValue)
 	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
+		value, ok = object.MulInt64(leftValue, rightValue)
 	case "/":
-		return &object.Integer{Value: leftValue / rightValue}
+		if rightValue == 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "division by zero")
+		}
+		value, ok = object.DivInt64(leftValue, rightValue)
+	case "%":
+		if rightValue == 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "division by zero")
+		}
+		// can't overflow, math.MinInt64 % -1 is 0
+		value, ok = leftValue%rightValue, true
+
+	case "&":
+		value, ok = leftValue&rightValue, true
+	case "|":
+		value, ok = leftValue|rightValue, true
+	case "^":
+		value, ok = leftValue^rightValue, true
+	case "<<":
+		if rightValue < 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "negative shift count: %d", rightValue)
+		}
+		value, ok = object.ShlInt64(leftValue, rightValue)
+	case ">>":
+		if rightValue < 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "negative shift count: %d", rightValue)
+		}
+		value, ok = leftValue>>rightValue, true
 
 	case "<":
 		return nativeBoolToBooleanObject(leftValue < rightValue)
 	case ">":
 		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
 	case "==":
 		return nativeBoolToBooleanObject(leftValue == rightValue)
 	case "!=":
 		return nativeBoolToBooleanObject(leftValue != rightValue)
 
 	default:
-		return newErrorf("unknown operator: %s", operator)
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s", operator)
+	}
+
+	if !ok {
+		if checked {
+			return newErrorf(object.ARITHMETIC_ERROR, "integer overflow: %d %s %d", leftValue, operator, rightValue)
+		}
+
+		return object.BigIntInfix(operator, left, right, checked)
+	}
+
+	return &object.Integer{Value: value}
+}
+
+func evalFloatInfixExpression(operator string, leftValue, rightValue float64) object.Object {
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s", operator)
 	}
 }
 
@@ -177,17 +385,34 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 		return nativeBoolToBooleanObject(leftValue != rightValue)
 
 	default:
-		return newErrorf("operartor %s not supported on type string", operator)
+		return newErrorf(object.TYPE_ERROR, "operartor %s not supported on type string", operator)
 	}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+// bitwise operators only work on integers, so floats don't promote them
+var bitwiseOperators = map[string]bool{
+	token.BIT_AND: true,
+	token.BIT_OR:  true,
+	token.BIT_XOR: true,
+	token.SHL:     true,
+	token.SHR:     true,
+}
+
+func evalInfixExpression(operator string, left, right object.Object, checked bool) object.Object {
+	if l, r, ok := object.Promote(left, right); ok && !bitwiseOperators[operator] {
+		return evalFloatInfixExpression(operator, l, r)
+	}
+
 	switch {
+	// anything can be compared with null, so x == null works for any x
+	case (left == NULL || right == NULL) && (operator == "==" || operator == "!="):
+		return nativeBoolToBooleanObject((left == right) == (operator == "=="))
+
 	case left.Type() != right.Type():
-		return newErrorf("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorf(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, checked)
 
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
@@ -199,10 +424,45 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		return nativeBoolToBooleanObject(left != right)
 
 	default:
-		return newErrorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// evalLogicalExpression only evaluates the right hand side when the left
+// hand side doesn't settle the result on its own
+func evalLogicalExpression(n *ast.InfixExpression, env *object.Enviornment) object.Object {
+	left := Eval(n.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if n.Operator == token.AND && !isTruthy(left) {
+		return FALSE
+	}
+
+	if n.Operator == token.OR && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(n.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// a ?? b is a unless a is null, unlike || only null counts as missing so
+// false ?? b is false
+func evalNullishExpression(n *ast.InfixExpression, env *object.Enviornment) object.Object {
+	left := Eval(n.Left, env)
+	if isError(left) || left != NULL {
+		return left
+	}
+
+	return Eval(n.Right, env)
+}
+
 func isTruthy(condition object.Object) bool {
 	switch condition {
 	case TRUE:
@@ -222,13 +482,19 @@ func evalIfExpression(n *ast.IfExpression, env *object.Enviornment) object.Objec
 		return condition
 	}
 
+	var result object.Object
 	if isTruthy(condition) {
-		return Eval(n.Consequence, env)
+		result = Eval(n.Consequence, env)
 	} else if n.Alternative != nil {
-		return Eval(n.Alternative, env)
+		result = Eval(n.Alternative, env)
+	}
+
+	// empty blocks or blocks ending on a let statement have no value
+	if result == nil {
+		return NULL
 	}
 
-	return NULL
+	return result
 }
 
 func evalIdentifier(ident *ast.Identifier, env *object.Enviornment) object.Object {
@@ -237,12 +503,12 @@ func evalIdentifier(ident *ast.Identifier, env *object.Enviornment) object.Objec
 		return i
 	}
 
-	i, ok = builtins[ident.Value]
+	i, ok = env.Builtins().Lookup(ident.Value)
 	if ok {
 		return i
 	}
 
-	return newErrorf("identifier is undefined: %s", ident.Value)
+	return newErrorf(object.NAME_ERROR, "identifier is undefined: %s", ident.Value)
 }
 
 func evalExpressions(exprs []ast.Expression, env *object.Enviornment) []object.Object {
@@ -260,6 +526,225 @@ func evalExpressions(exprs []ast.Expression, env *object.Enviornment) []object.O
 	return result
 }
 
+/*
+ * Negative indexes count backwards from the end, so xs[-1] is the last
+ * element. Anything out of range evaluates to NULL instead of an error.
+ */
+func normalizeIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+
+	return int(index), true
+}
+
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+
+	// big integers are always out of range
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+
+	i, ok := normalizeIndex(integer.Value, len(elements))
+	if !ok {
+		return NULL
+	}
+
+	return elements[i]
+}
+
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	value := str.(*object.String).Value
+
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+
+	i, ok := normalizeIndex(integer.Value, len(value))
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: value[i : i+1]}
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newErrorf(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.(*object.Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+
+	return value
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+/*
+evalAssignExpression works left to right: the collection & index of the
+target first, then its current value for compound operators and the right
+hand side last. An assignment evaluates to the value assigned.
+*/
+func evalAssignExpression(n *ast.AssignExpression, env *object.Enviornment) object.Object {
+	switch target := n.Target.(type) {
+	case *ast.Identifier:
+		if pos, ok := env.Const(target.Value, true); ok {
+			return newErrorf(object.NAME_ERROR, "cannot assign to const %s (declared at %s)", target.Value, pos)
+		}
+
+		var current object.Object
+		if n.Operator != token.ASSIGN {
+			current = evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := evalAssignedValue(n, current, env)
+		if isError(val) {
+			return val
+		}
+
+		if _, ok := env.Assign(target.Value, val); !ok {
+			if _, ok := env.Builtins().Lookup(target.Value); ok {
+				return newErrorf(object.NAME_ERROR, "cannot assign to builtin %s", target.Value)
+			}
+
+			return newErrorf(object.NAME_ERROR, "identifier is undefined: %s", target.Value)
+		}
+
+		return val
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if n.Operator != token.ASSIGN {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := evalAssignedValue(n, current, env)
+		if isError(val) {
+			return val
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return newErrorf(object.RUNTIME_ERROR, "cannot assign to %s", n.Target)
+	}
+}
+
+// evalAssignedValue evaluates the right hand side of an assignment, and
+// combines it with current for compound operators
+func evalAssignedValue(n *ast.AssignExpression, current object.Object, env *object.Enviornment) object.Object {
+	val := Eval(n.Value, env)
+	if isError(val) || current == nil {
+		return val
+	}
+
+	// += is + and so on
+	operator := strings.TrimSuffix(n.Operator, "=")
+
+	return evalInfixExpression(operator, current, val, env.ArithmeticChecked())
+}
+
+// arrays & hashes are changed in place, so every reference to them sees
+// the new value
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newErrorf(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+		}
+
+		left.(*object.Hash).Set(key, val)
+
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+
+		// big integers are always out of range
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return newErrorf(object.INDEX_ERROR, "index out of range: %s", index.Inspect())
+		}
+
+		i, ok := normalizeIndex(integer.Value, len(elements))
+		if !ok {
+			return newErrorf(object.INDEX_ERROR, "index out of range: %s", index.Inspect())
+		}
+
+		elements[i] = val
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+
+	return val
+}
+
+func evalHashLiteral(n *ast.HashLiteral, env *object.Enviornment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range n.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newErrorf(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviornment {
 	env := object.NewEnclosedEnviornment(fn.Env)
 
@@ -270,20 +755,65 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Envior
 	return env
 }
 
+// a function body that ends without a value, like on a let statement,
+// evaluates to NULL
 func unwrapReturn(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
 	}
 
+	if obj == nil {
+		return NULL
+	}
+
 	return obj
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// Apply calls fn with args the way a call expression does, for hosts that
+// call script functions from go
+func Apply(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, token.Position{})
+}
+
+// a function literal takes the name it is bound to, like the compiler does,
+// so tracebacks can tell functions apart
+func nameFunction(exp ast.Expression, val object.Object, name string) {
+	if _, ok := exp.(*ast.FunctionLiteral); !ok {
+		return
+	}
+
+	if fn, ok := val.(*object.Function); ok {
+		fn.Name = name
+	}
+}
+
+// pos is where the function is called, errors coming out of the function
+// pick up a frame for the call on their way through
+func applyFunction(fn object.Object, args []object.Object, pos token.Position) object.Object {
 	function, ok := fn.(*object.Function)
 	if ok {
+		if len(args) != len(function.Args) {
+			return newErrorf(object.ARGUMENT_ERROR, "wrong number of arguments: want=%d, got=%d", len(function.Args), len(args))
+		}
+
+		usage := function.Env.Usage()
+		if err := usage.Interrupted(); err != nil {
+			return err
+		}
+
+		if err := usage.Call(); err != nil {
+			return err
+		}
+		defer usage.Return()
+
 		extendedEnv := extendFunctionEnv(function, args)
-		evaluated := Eval(function.Body, extendedEnv)
-		return unwrapReturn(evaluated)
+		evaluated := unwrapReturn(Eval(function.Body, extendedEnv))
+
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Frames = append(err.Frames, object.Frame{Function: function.Name, Pos: pos})
+		}
+
+		return evaluated
 	}
 
 	builtin, ok := fn.(*object.Builtin)
@@ -291,10 +821,77 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		return builtin.Fn(args...)
 	}
 
-	return newErrorf("not a function: %s", fn.Type())
+	return newErrorf(object.TYPE_ERROR, "not a function: %s", fn.Type())
+}
+
+// evalLimited counts node against the limits evaluation runs under, along
+// with the value it creates
+func evalLimited(node ast.Node, env *object.Enviornment) object.Object {
+	usage := env.Usage()
+	if err := usage.Step(); err != nil {
+		return err
+	}
+
+	result := eval(node, env)
+	if allocates(node) && !isError(result) {
+		if err := usage.Allocate(result); err != nil {
+			return err
+		}
+	}
+
+	return result
+}
+
+// allocates reports whether node evaluates to a value it creates, rather
+// than to one that exists already
+func allocates(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.InterpolatedString,
+		*ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral, *ast.PrefixExpression:
+		return true
+
+	case *ast.InfixExpression:
+		return node.Operator != token.AND && node.Operator != token.OR && node.Operator != token.NULLISH
+
+	case *ast.AssignExpression:
+		return node.Operator != token.ASSIGN
+	}
+
+	return false
 }
 
 func Eval(node ast.Node, env *object.Enviornment) object.Object {
+	result := evalLimited(node, env)
+
+	/*
+	 * Errors are created by helpers that never see the ast, so the innermost
+	 * node an error passes through stamps its position on the error. Outer
+	 * nodes leave it alone as the position is already set.
+	 */
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+// each part is turned in to text with Inspect, so "${[1, 2]}" gives "[1, 2]"
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Enviornment) object.Object {
+	var buf strings.Builder
+
+	for _, part := range node.Parts {
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+
+		buf.WriteString(val.Inspect())
+	}
+
+	return &object.String{Value: buf.String()}
+}
+
+func eval(node ast.Node, env *object.Enviornment) object.Object {
 	switch n := node.(type) {
 	case *ast.Program:
 		return evalProgram(n.Statements, env)
@@ -303,27 +900,48 @@ func Eval(node ast.Node, env *object.Enviornment) object.Object {
 		return Eval(n.Expression, env)
 
 	case *ast.IntegerLiteral:
+		if n.Big != nil {
+			return &object.BigInt{Value: n.Big}
+		}
+
 		return &object.Integer{
 			Value: n.Value,
 		}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: n.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{
 			Value: n.Value,
 		}
 
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(n, env)
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(n.Value)
 
+	case *ast.NullLiteral:
+		return NULL
+
 	case *ast.PrefixExpression:
 		right := Eval(n.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalPrefixExpression(n.Operator, right)
+		return evalPrefixExpression(n.Operator, right, env.ArithmeticChecked())
 
 	case *ast.InfixExpression:
+		if n.Operator == token.AND || n.Operator == token.OR {
+			return evalLogicalExpression(n, env)
+		}
+
+		if n.Operator == token.NULLISH {
+			return evalNullishExpression(n, env)
+		}
+
 		left := Eval(n.Left, env)
 		if isError(left) {
 			return left
@@ -334,7 +952,7 @@ func Eval(node ast.Node, env *object.Enviornment) object.Object {
 			return right
 		}
 
-		return evalInfixExpression(n.Operator, left, right)
+		return evalInfixExpression(n.Operator, left, right, env.ArithmeticChecked())
 
 	case *ast.BlockStatement:
 		return evalBlockStatements(n.Statements, env)
@@ -349,14 +967,56 @@ func Eval(node ast.Node, env *object.Enviornment) object.Object {
 		}
 		return &object.ReturnValue{Value: v}
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(n, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(n, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(n.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		return object.Thrown(val)
+
+	case *ast.TryStatement:
+		return evalTryStatement(n, env)
+
+	case *ast.BranchStatement:
+		if n.Token.Type == token.BREAK {
+			return &object.Break{}
+		}
+
+		return &object.Continue{}
+
 	case *ast.LetStatement:
+		if err := checkRedeclaration(n.Name.Value, n.Pos(), env); err != nil {
+			return err
+		}
+
 		val := Eval(n.Value, env)
 		if isError(val) {
 			return val
 		}
 
+		nameFunction(n.Value, val, n.Name.Value)
 		env.Set(n.Name.TokenLiteral(), val)
 
+	case *ast.ConstStatement:
+		if err := checkRedeclaration(n.Name.Value, n.Pos(), env); err != nil {
+			return err
+		}
+
+		val := Eval(n.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		nameFunction(n.Value, val, n.Name.Value)
+		env.SetConst(n.Name.Value, val, n.Pos())
+
 	case *ast.Identifier:
 		return evalIdentifier(n, env)
 
@@ -378,7 +1038,48 @@ func Eval(node ast.Node, env *object.Enviornment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(fn, args)
+		result := applyFunction(fn, args, n.Pos())
+
+		// script functions count what they create as they go
+		if _, ok := fn.(*object.Builtin); ok && !isError(result) {
+			if err := env.Usage().Allocate(result); err != nil {
+				return err
+			}
+		}
+
+		return result
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(n.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		left := Eval(n.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		// the index isn't evaluated either
+		if n.Optional && left == NULL {
+			return NULL
+		}
+
+		index := Eval(n.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		return evalIndexExpression(left, index)
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(n, env)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(n, env)
 	}
 
 	return nil
@@ -1,7 +1,10 @@
 package evaluator
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cijin/go-interpreter/lexer"
 	"github.com/cijin/go-interpreter/object"
@@ -65,6 +68,34 @@ func TestIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestFloatExpression(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5e3 + 1", 1501},
+		{"1 + 0.5 * 2", 2},
+		{"7 / 2.0", 3.5},
+		{"float(3)", 3},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.in)
+
+		f, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("expected evaluated to be Float, got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if f.Value != test.expected {
+			t.Errorf("%q: expected value to be %g, got=%g", test.in, test.expected, f.Value)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"hello world"`
 	evaluated := testEval(input)
@@ -86,6 +117,11 @@ func TestStringExpression(t *testing.T) {
 	}{
 		{`"hello" + "world";`, "helloworld"},
 		{`"hello" + " "  + "world";`, "hello world"},
+		{`"say \"hi\"\n" + "\u{e9}\x41"`, "say \"hi\"\néA"},
+		{"`multi\nline \\n`", "multi\nline \\n"},
+		{`let name = "monkey"; let n = 2; "Hello ${name}, you have ${n + 1} items"`, "Hello monkey, you have 3 items"},
+		{`"${[1, "a"]} ${ {"k": true}["k"] } ${fn(){}()} ${"in ${1 + 1}"}"`, "[1, a] true null in 2"},
+		{`"\${not} $ {this}"`, "${not} $ {this}"},
 	}
 
 	for i, tc := range tests {
@@ -244,6 +280,10 @@ func TestErrorHandling(t *testing.T) {
 		},
 		{"foobar", "identifier is undefined: foobar"},
 		{`"hello" - "world"`, "operartor - not supported on type string"},
+		{`[1, 2][true]`, "index operator not supported: ARRAY[BOOLEAN]"},
+		{`1[0]`, "index operator not supported: INTEGER[INTEGER]"},
+		{`{"name": "monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{fn(x) { x }: 1};`, "unusable as hash key: FUNCTION"},
 	}
 
 	for _, tt := range tests {
@@ -318,6 +358,45 @@ func TestFunctionCall(t *testing.T) {
 	}
 }
 
+func TestFunctionCallWithoutValue(t *testing.T) {
+	tests := []string{
+		"fn() { }()",
+		"fn() { let x = 5; }()",
+		"let f = fn() { }; let x = f(); x",
+		"if (true) { }",
+		"if (true) { let x = 5; }",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestFunctionCallArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x) { x }();", "wrong number of arguments: want=1, got=0"},
+		{"fn() { 1 }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a, b) { a + b }(1);", "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("expected object.Error to be returned, got=%T", evaluated)
+			continue
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("expected error to be %s, got=%s", tt.expected, err.Message)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 	let x = 10;
@@ -348,25 +427,472 @@ func TestBuiltinFunction(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len("1")`, 1},
 		{`len("")`, 0},
-		{`len(1)`, "invalid arg type for len, expected=STRING, got=INTEGER"},
-		{`len("one", "two")`, "too many args for len, expected=1, got=2"},
+		{`len(1)`, "wrong type of argument 1 for len: want=STRING, ARRAY or HASH, got=INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments for len: want=1, got=2"},
+		{`len()`, "wrong number of arguments for len: want=1, got=0"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first("abc")`, "a"},
+		{`first(1)`, "wrong type of argument 1 for first: want=STRING or ARRAY, got=INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last("abc")`, "c"},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([1])`, []int64{}},
+		{`rest([])`, nil},
+		{`rest("abc")`, "bc"},
+		{`push([], 1)`, []int64{1}},
+		{`push([1, 2], 3)`, []int64{1, 2, 3}},
+		{`push("ab", "c")`, "abc"},
+		{`push("ab", 1)`, "wrong type of argument 2 for push: want=STRING, got=INTEGER"},
+		{`push(1, 1)`, "wrong type of argument 1 for push: want=STRING or ARRAY, got=INTEGER"},
+		{`let a = [1]; let b = push(a, 2); len(a)`, 1},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`keys({"a": 1, "b": 2})`, []string{"a", "b"}},
+		{`keys({})`, []string{}},
+		{`values({"a": 1, "b": 2})`, []int64{1, 2}},
+		{`keys(1)`, "wrong type of argument 1 for keys: want=HASH, got=INTEGER"},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": 1}, fn(x) { x })`, "unusable as hash key: FUNCTION"},
+		{`keys(delete({"a": 1, "b": 2}, "a"))`, []string{"b"}},
+		{`let h = {"a": 1}; delete(h, "a"); len(h)`, 1},
+		{`delete({"a": 1}, "b")["a"]`, 1},
 	}
 
 	for i, tc := range tests {
 		evaluated := testEval(tc.input)
 
 		switch expected := tc.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("[tc %d]: expected evaluated to be *object.Array, got=%T (+%v)", i, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("[tc %d]: expected %d elements, got=%d", i, len(expected), len(array.Elements))
+				continue
+			}
+
+			for j, el := range expected {
+				if array.Elements[j].Inspect() != el {
+					t.Errorf("[tc %d]: expected element %d to be %s, got=%s", i, j, el, array.Elements[j].Inspect())
+				}
+			}
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("[tc %d]: expected evaluated to be *object.Array, got=%T (+%v)", i, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("[tc %d]: expected %d elements, got=%d", i, len(expected), len(array.Elements))
+				continue
+			}
+
+			for j, el := range expected {
+				testIntegerObject(t, array.Elements[j], el)
+			}
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.String:
+				if evaluated.Value != expected {
+					t.Errorf("[tc %d]: expected string=%s, got=%s", i, expected, evaluated.Value)
+				}
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("[tc %d]: expected error=%s, got=%s", i, expected, evaluated.Message)
+				}
+			default:
+				t.Errorf("[tc %d]: expected evaluated to be *object.Error or *object.String, got=%T (+%v)", i, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{"let f = fn() { f() }; f()", object.Limits{}, "1:16: RuntimeError: stack overflow"},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(9)", object.Limits{MaxDepth: 10}, ""},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(10)", object.Limits{MaxDepth: 10}, "1:30: RuntimeError: stack overflow"},
+		{"let i = 0; while (i < 10) { i += 1 }", object.Limits{MaxSteps: 100}, ""},
+		{"while (true) {}", object.Limits{MaxSteps: 100}, "1:8: LimitError: evaluation exceeded 100 steps"},
+		// limits can't be caught, finally blocks run into them as well
+		{"while (true) { try { 1 } catch (e) { 2 } }", object.Limits{MaxSteps: 100}, "1:16: LimitError: evaluation exceeded 100 steps"},
+		{`let s = ""; for (i in 0..100) { s += "0123456789" }`, object.Limits{MaxAlloc: 4096}, ""},
+		{`let s = ""; while (true) { s += "0123456789" }`, object.Limits{MaxAlloc: 4096}, "1:28: LimitError: evaluation exceeded 4096 bytes of allocations"},
+		{`let xs = []; while (true) { xs = push(xs, 1) }`, object.Limits{MaxAlloc: 4096}, "1:34: LimitError: evaluation exceeded 4096 bytes of allocations"},
+		{"while (true) {}", object.Limits{Context: cancelled}, "1:1: LimitError: evaluation stopped: context canceled"},
+		{"let f = fn() { f() }; try { f() } catch (e) { 1 }", object.Limits{Context: cancelled}, "1:29: LimitError: evaluation stopped: context canceled"},
+		{"for (x in [1]) { while (true) {} }", object.Limits{Context: expired}, "1:1: LimitError: evaluation stopped: context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnviornment()
+		env.SetLimits(tt.limits)
+
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		err, ok := evaluated.(*object.Error)
+		switch {
+		case tt.expected == "" && ok:
+			t.Errorf("%s: unexpected error %q", tt.input, err.Traceback())
+		case tt.expected != "" && !ok:
+			t.Errorf("%s: expected error %q, got=%+v", tt.input, tt.expected, evaluated)
+		case ok && !strings.HasPrefix(err.Traceback(), tt.expected):
+			t.Errorf("%s: expected error %q, got=%q", tt.input, tt.expected, err.Traceback())
+		}
+	}
+}
+
+// the counts start over when limits are set again, the depth goes back down
+// as calls return
+func TestLimitsReset(t *testing.T) {
+	env := object.NewEnviornment()
+	env.SetLimits(object.Limits{MaxSteps: 100, MaxDepth: 5})
+
+	program := parser.New(lexer.New("let f = fn(n) { if (n > 0) { f(n - 1) } }; f(4)")).ParseProgram()
+
+	if err, ok := Eval(program, env).(*object.Error); ok {
+		t.Fatalf("unexpected error %q", err.Message)
+	}
+
+	if err, ok := Eval(program, env).(*object.Error); !ok || err.Kind != object.LIMIT_ERROR {
+		t.Fatalf("expected to run out of steps, got=%+v", err)
+	}
+
+	env.SetLimits(object.Limits{MaxSteps: 100, MaxDepth: 5})
+	if err, ok := Eval(program, env).(*object.Error); ok {
+		t.Errorf("unexpected error %q", err.Message)
+	}
+}
+
+// calls unwound by a panic in a builtin go back up the depth they took, as
+// the host may recover and keep using the enviornment
+func TestLimitsPanic(t *testing.T) {
+	registry := object.Builtins.Clone()
+	registry.Register("boom", nil, func(args ...object.Object) object.Object { panic("boom") })
+
+	env := object.NewEnviornment()
+	env.SetBuiltins(registry)
+	env.SetLimits(object.Limits{MaxDepth: 5})
+
+	eval := func(input string) (result object.Object, panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env), false
+	}
+
+	eval("let f = fn(n) { if (n > 0) { f(n - 1) } else { if (n < 0) { boom() } } };")
+	for i := 0; i < 3; i++ {
+		if _, panicked := eval("f(-1)"); !panicked {
+			t.Fatalf("expected f(-1) to panic")
+		}
+	}
+
+	if result, _ := eval("f(4)"); isError(result) {
+		t.Errorf("unexpected error %q", result.(*object.Error).Message)
+	}
+}
+
+func TestEnviornmentBuiltins(t *testing.T) {
+	registry := object.Builtins.Clone()
+	registry.Register("len", nil, func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+	registry.Register("math.double", &object.Signature{Params: []object.Types{{object.INTEGER_OBJ}}}, func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("a")`, 42},
+		{`let f = fn() { fn() { len([]) } }; f()()`, 42},
+		{`math["double"](2)`, 4},
+		{`let double = math["double"]; double(3)`, 6},
+		{`math["double"]("a")`, "wrong type of argument 1 for math.double: want=INTEGER, got=STRING"},
+		{`first([1])`, 1},
+		{`math = 1`, "cannot assign to builtin math"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnviornment()
+		env.SetBuiltins(registry)
+
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
 		case string:
 			err, ok := evaluated.(*object.Error)
+			if !ok || err.Message != expected {
+				t.Errorf("%s: expected error %q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+
+	// the default builtins are left alone
+	testIntegerObject(t, testEval(`len("a")`), 1)
+
+	if err, ok := testEval(`math`).(*object.Error); !ok || err.Message != "identifier is undefined: math" {
+		t.Errorf("expected math to be undefined, got=%+v", err)
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("expected evaluated to be *object.Array, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("expected 3 elements, got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][0]", nil},
+		{`"abc"[1]`, "b"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[3]`, nil},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
 			if !ok {
-				t.Errorf("[tc %d]: expected evaluated to be *object.Error, got=%T (+%v)", i, evaluated, evaluated)
+				t.Errorf("[tc %d]: expected *object.String, got=%T (%+v)", i, evaluated, evaluated)
+				continue
 			}
 
-			if err.Message != expected {
-				t.Errorf("[tc %d]: expected error=%s, got=%s", i, expected, err.Message)
+			if str.Value != expected {
+				t.Errorf("[tc %d]: expected %s, got=%s", i, expected, str.Value)
 			}
+		default:
+			testNullObject(t, evaluated)
 		}
 	}
 }
+
+func TestHashLiteral(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("expected evaluated to be *object.Hash, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if result.Len() != len(expected) {
+		t.Fatalf("expected %d pairs, got=%d", len(expected), result.Len())
+	}
+
+	for i, pair := range result.Pairs() {
+		if pair.Key.Inspect() != expected[i].key.Inspect() {
+			t.Errorf("expected key %d to be %s, got=%s", i, expected[i].key.Inspect(), pair.Key.Inspect())
+		}
+
+		value, ok := result.Get(expected[i].key)
+		if !ok {
+			t.Errorf("no pair for key %s", expected[i].key.Inspect())
+			continue
+		}
+
+		testIntegerObject(t, value, expected[i].value)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"5 + true", "1:1: type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1;\n  -true", "2:3: operator '-' not defined on BOOLEAN"},
+		{"let f = fn() {\n  foobar\n};\nf()", "2:3: identifier is undefined: foobar"},
+		{`len(1, 2)`, "1:1: wrong number of arguments for len: want=1, got=2"},
+		{"[1, 2][\"a\"]", "1:1: index operator not supported: ARRAY[STRING]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.in)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("expected object.Error to be returned, got=%T", evaluated)
+			continue
+		}
+
+		if err.Inspect() != tt.expected {
+			t.Errorf("expected error to be %q, got=%q", tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestNestedScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// globals are visible from closures nested several levels deep
+		{`
+		let x = 1;
+		let f = fn() { fn() { fn() { fn() { x } } } };
+		f()()()();
+		`, 1},
+		// each level captures its own arguments
+		{`
+		let add = fn(a) { fn(b) { fn(c) { fn(d) { a + b + c + d } } } };
+		add(1)(2)(3)(4);
+		`, 10},
+		// builtins resolve from deep inside closures
+		{`
+		let f = fn() { fn() { fn() { len([1, 2, 3]) } } };
+		f()()();
+		`, 3},
+		// recursion inside a closure
+		{`
+		let outer = fn(n) {
+			let countDown = fn(x) {
+				if (x == 0) { return n; }
+				countDown(x - 1);
+			};
+			fn() { countDown(5) };
+		};
+		outer(7)();
+		`, 7},
+		// recursion of a global function called from a nested closure
+		{`
+		let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+		let wrap = fn() { fn() { fn() { fib(10) } } };
+		wrap()()();
+		`, 55},
+		// the innermost binding shadows outer ones
+		{`
+		let x = 1;
+		let f = fn() { let x = 2; fn() { let x = 3; fn() { x } } };
+		f()()();
+		`, 3},
+		{`
+		let x = 1;
+		let f = fn() { let x = 2; fn() { fn() { x } } };
+		f()()();
+		`, 2},
+		// shadowing in a function does not leak out
+		{`
+		let x = 1;
+		let f = fn(x) { x * 10 };
+		f(5) + x;
+		`, 51},
+		// a local can shadow a builtin
+		{`
+		let f = fn() { let len = fn(x) { 42 }; fn() { len([]) } };
+		f()();
+		`, 42},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
@@ -0,0 +1,525 @@
+/*
+Package format pretty prints monkey programs in a canonical style: one
+statement per line, blocks indented with tabs, and only the parentheses the
+parser actually needs. Comments are put back where they were, going by
+their position in the source.
+*/
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/cijin/go-interpreter/ast"
+	"github.com/cijin/go-interpreter/lexer"
+	"github.com/cijin/go-interpreter/parser"
+	"github.com/cijin/go-interpreter/token"
+)
+
+// Source formats src, it fails with the parser errors if src doesn't parse
+func Source(filename string, src []byte) ([]byte, error) {
+	l := lexer.NewFile(filename, string(src))
+	l.KeepComments()
+
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	var buf bytes.Buffer
+	if err := Node(&buf, program); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Node writes node to w in the canonical style, a program always ends with
+// a newline
+func Node(w io.Writer, node ast.Node) error {
+	p := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.comments = node.Comments
+
+		p.statements(node.Statements, false)
+		p.leadingComments(token.Position{Offset: math.MaxInt}, len(node.Statements) > 0)
+
+		if p.buf.Len() > 0 {
+			p.newline()
+		}
+
+	case ast.Statement:
+		p.statement(node)
+
+	case ast.Expression:
+		p.expression(node)
+
+	default:
+		return fmt.Errorf("format: unsupported node %T", node)
+	}
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	bol    bool // at the beginning of a line, indentation is still due
+
+	comments []*ast.Comment // still to be printed, in source order
+	line     int            // source line the last thing printed ended on
+}
+
+func (p *printer) write(s string) {
+	if p.bol {
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+		p.bol = false
+	}
+
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	p.bol = true
+}
+
+// linebreak starts a new line for something found on the given source
+// line, keeping a single blank line if the source had one or more
+func (p *printer) linebreak(line int) {
+	p.newline()
+
+	if p.line > 0 && line > p.line+1 {
+		p.newline()
+	}
+}
+
+func (p *printer) commentBefore(pos token.Position) bool {
+	return len(p.comments) > 0 && p.comments[0].Pos().Offset < pos.Offset
+}
+
+func (p *printer) comment() {
+	c := p.comments[0]
+	p.comments = p.comments[1:]
+
+	p.write(strings.TrimRight(c.String(), " \t\r"))
+	p.line = c.End().Line
+}
+
+/*
+leadingComments prints the comments found before pos each on a line of
+its own, sep tells whether a line break is due before the first one. It
+reports whether one is due before whatever comes next.
+*/
+func (p *printer) leadingComments(pos token.Position, sep bool) bool {
+	for p.commentBefore(pos) {
+		if sep {
+			p.linebreak(p.comments[0].Pos().Line)
+		}
+
+		p.comment()
+		sep = true
+	}
+
+	return sep
+}
+
+// trailingComments prints the comments found before end, or on the line
+// printed last, after what is already on the line
+func (p *printer) trailingComments(end token.Position) {
+	for p.commentBefore(end) || len(p.comments) > 0 && p.comments[0].Pos().Line == p.line {
+		p.write(" ")
+		p.comment()
+	}
+}
+
+/*
+statements prints one statement per line, keeping a single blank line
+where the source had one or more. In a block the last expression statement
+is the value of the block and goes without a semicolon.
+*/
+func (p *printer) statements(stmts []ast.Statement, block bool) {
+	for i, stmt := range stmts {
+		if p.leadingComments(stmt.Pos(), i > 0) {
+			p.linebreak(stmt.Pos().Line)
+		}
+
+		last := i == len(stmts)-1
+		p.statement(stmt)
+
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && !(block && last) {
+			// an if expression reads better without one, unless the
+			// next statement would otherwise continue it
+			if _, isIf := es.Expression.(*ast.IfExpression); !isIf || (!last && continues(stmts[i+1])) {
+				p.write(";")
+			}
+		}
+
+		p.line = stmt.End().Line
+		p.trailingComments(stmt.End())
+	}
+}
+
+// continues reports whether stmt, once printed, starts with a token that
+// would carry on the expression before it if there was no semicolon
+func continues(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	exp := es.Expression
+	for {
+		switch e := exp.(type) {
+		case *ast.InfixExpression:
+			if precedence(e.Left) < parser.Precedence(e.Token.Type) {
+				return true
+			}
+			exp = e.Left
+
+		case *ast.CallExpression:
+			if precedence(e.Function) < parser.CALL {
+				return true
+			}
+			exp = e.Function
+
+		case *ast.IndexExpression:
+			if precedence(e.Left) < parser.CALL {
+				return true
+			}
+			exp = e.Left
+
+		case *ast.AssignExpression:
+			exp = e.Target
+
+		case *ast.PrefixExpression:
+			return e.Token.Type == token.MINUS
+
+		case *ast.ArrayLiteral:
+			return true
+
+		default:
+			return false
+		}
+	}
+}
+
+// statement prints stmt, expression statements are left for the caller to
+// terminate
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value)
+		p.write(";")
+
+	case *ast.ConstStatement:
+		p.write("const " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value)
+		p.write(";")
+
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue)
+		}
+		p.write(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+
+	// loops end on their block, like if expressions they go without a
+	// semicolon
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expression(stmt.Condition)
+		p.write(") ")
+		p.block(stmt.Body)
+
+	case *ast.ForStatement:
+		p.write("for (" + stmt.Variable.Value + " in ")
+		p.expression(stmt.Iterable)
+		p.write(") ")
+		p.block(stmt.Body)
+
+	case *ast.BranchStatement:
+		p.write(stmt.Token.Literal + ";")
+
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value)
+		p.write(";")
+
+	// like loops, try statements end on a block
+	case *ast.TryStatement:
+		p.write("try ")
+		p.block(stmt.Body)
+
+		if stmt.Catch != nil {
+			p.write(" catch (" + stmt.Param.Value + ") ")
+			p.block(stmt.Catch)
+		}
+
+		if stmt.Finally != nil {
+			p.write(" finally ")
+			p.block(stmt.Finally)
+		}
+
+	case *ast.BlockStatement:
+		p.block(stmt)
+
+	default:
+		p.write(stmt.String())
+	}
+}
+
+/*
+block prints a block over several lines, unless it was written on a single
+line in the source and holds at most one statement that fits on one line.
+Blocks holding comments are always spread over several lines.
+
+On one line the statement goes without a semicolon, the closing brace ends
+it like it ends the last expression of a block.
+*/
+func (p *printer) block(b *ast.BlockStatement) {
+	comments := p.commentBefore(b.Rbrace.Pos)
+
+	if len(b.Statements) == 0 && !comments {
+		p.write("{}")
+		return
+	}
+
+	if len(b.Statements) == 1 && !comments && b.Token.Pos.Line == b.Rbrace.Pos.Line {
+		inner := &printer{}
+		inner.statement(b.Statements[0])
+
+		if line := inner.buf.String(); !strings.Contains(line, "\n") {
+			p.write("{ " + strings.TrimSuffix(line, ";") + " }")
+			return
+		}
+	}
+
+	p.write("{")
+	p.indent += 1
+	p.newline()
+	p.line = 0
+
+	p.statements(b.Statements, true)
+	p.leadingComments(b.Rbrace.Pos, len(b.Statements) > 0)
+
+	p.indent -= 1
+	p.newline()
+	p.write("}")
+	p.line = b.Rbrace.Pos.Line
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.Boolean, *ast.NullLiteral:
+		p.write(exp.String())
+
+	case *ast.StringLiteral:
+		p.write(exp.String())
+
+	case *ast.InterpolatedString:
+		p.write(`"`)
+		for i, part := range exp.Parts {
+			if lit, ok := part.(*ast.StringLiteral); ok && i%2 == 0 {
+				p.write(ast.Escape(lit.Value))
+				continue
+			}
+
+			p.write("${")
+			p.expression(part)
+			p.write("}")
+		}
+		p.write(`"`)
+
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.operand(exp.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		prec := parser.Precedence(exp.Token.Type)
+
+		// operators are left associative, so only the right hand side
+		// needs parentheses when it binds just as tightly
+		p.operand(exp.Left, prec)
+		p.write(" " + exp.Operator + " ")
+		p.operand(exp.Right, prec+1)
+
+	case *ast.AssignExpression:
+		// the other way round from infix operators, as assignments are
+		// right associative
+		p.operand(exp.Target, parser.ASSIGN+1)
+		p.write(" " + exp.Operator + " ")
+		p.operand(exp.Value, parser.ASSIGN)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition)
+		p.write(") ")
+		p.block(exp.Consequence)
+
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+
+	case *ast.CallExpression:
+		p.operand(exp.Function, parser.CALL)
+		p.write("(")
+		for i, arg := range exp.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg)
+		}
+		p.write(")")
+
+	case *ast.IndexExpression:
+		p.operand(exp.Left, parser.CALL)
+
+		if exp.Token.Type == token.OPTIONAL_DOT {
+			p.write("?." + exp.Index.(*ast.StringLiteral).Value)
+			break
+		}
+
+		if exp.Optional {
+			p.write("?")
+		}
+		p.write("[")
+		p.expression(exp.Index)
+		p.write("]")
+
+	case *ast.ArrayLiteral:
+		spans := make([]span, len(exp.Elements))
+		for i, el := range exp.Elements {
+			spans[i] = span{el.Pos(), el.End()}
+		}
+
+		p.list("[", "]", exp.Token.Pos, exp.Rbracket.Pos, spans, func(i int) {
+			p.expression(exp.Elements[i])
+		})
+
+	case *ast.HashLiteral:
+		spans := make([]span, len(exp.Pairs))
+		for i, pair := range exp.Pairs {
+			spans[i] = span{pair.Key.Pos(), pair.Value.End()}
+		}
+
+		p.list("{", "}", exp.Token.Pos, exp.Rbrace.Pos, spans, func(i int) {
+			p.expression(exp.Pairs[i].Key)
+			p.write(": ")
+			p.expression(exp.Pairs[i].Value)
+		})
+
+	default:
+		p.write(exp.String())
+	}
+}
+
+// operand prints exp in parentheses if it binds less tightly than prec
+func (p *printer) operand(exp ast.Expression, prec int) {
+	if precedence(exp) < prec {
+		p.write("(")
+		p.expression(exp)
+		p.write(")")
+		return
+	}
+
+	p.expression(exp)
+}
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+
+	default:
+		return parser.INDEX
+	}
+}
+
+// span is the source range of an item in a list
+type span struct {
+	pos, end token.Position
+}
+
+/*
+list prints comma separated items between open and close. If the first item
+started on a line of its own the items are printed one per line, along with
+their comments.
+*/
+func (p *printer) list(open, close string, openPos, closePos token.Position, items []span, item func(i int)) {
+	multiline := len(items) > 0 && items[0].pos.Line > openPos.Line
+
+	p.write(open)
+
+	if !multiline {
+		for i := range items {
+			if i > 0 {
+				p.write(", ")
+			}
+
+			item(i)
+		}
+
+		p.write(close)
+		return
+	}
+
+	p.indent += 1
+	p.line = 0
+
+	for i, s := range items {
+		if i > 0 {
+			p.write(",")
+			p.trailingComments(items[i-1].end)
+		}
+
+		p.leadingComments(s.pos, true)
+		p.linebreak(s.pos.Line)
+
+		item(i)
+		p.line = s.end.Line
+	}
+
+	p.trailingComments(items[len(items)-1].end)
+	p.leadingComments(closePos, true)
+
+	p.indent -= 1
+	p.newline()
+	p.write(close)
+	p.line = closePos.Line
+}
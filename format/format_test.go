@@ -0,0 +1,209 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cijin/go-interpreter/ast"
+	"github.com/cijin/go-interpreter/token"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=5", "let x = 5;\n"},
+		{"const   x=5", "const x = 5;\n"},
+		{"return x", "return x;\n"},
+		{"x;y", "x;\ny;\n"},
+		// only the parentheses that matter are kept
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(1 - 2) - 3", "1 - 2 - 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"-(1 + 2)", "-(1 + 2);\n"},
+		{"!(-a)", "!-a;\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"a[0](1)[2]", "a[0](1)[2];\n"},
+		{"(a < b) == (c > d)", "a < b == c > d;\n"},
+		{`[1,2,  "three"]`, "[1, 2, \"three\"];\n"},
+		{`{"a":1,"b":true}`, "{\"a\": 1, \"b\": true};\n"},
+		{"{}", "{};\n"},
+		{"1.5e3 * -2.0", "1.5e3 * -2.0;\n"},
+		{"(a || b) && (c <= d % 2)", "(a || b) && c <= d % 2;\n"},
+		{"(flags & (1 << n)) != 0 | ~(mask ^ x)", "(flags & 1 << n) != 0 | ~(mask ^ x);\n"},
+		{`"say \"hi\"\t\u{41}\x42"`, "\"say \\\"hi\\\"\\tAB\";\n"},
+		{`"Hello ${ name }, ${n+1} \${x} ${ {"a": 1}["a"] }"`, "\"Hello ${name}, ${n + 1} \\${x} ${{\"a\": 1}[\"a\"]}\";\n"},
+		{"let s = `raw\n  \\n string`", "let s = `raw\n  \\n string`;\n"},
+		// short blocks written on one line stay there
+		{"let add = fn(a,b){a+b}", "let add = fn(a, b) { a + b };\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"if(x){1}else{2}", "if (x) { 1 } else { 2 }\n"},
+		// others are spread over lines and indented
+		{
+			"let add = fn(a, b) {\na + b; }",
+			"let add = fn(a, b) {\n\ta + b\n};\n",
+		},
+		{
+			"let f = fn(x) { let y = x * 2; y + 1 }",
+			"let f = fn(x) {\n\tlet y = x * 2;\n\ty + 1\n};\n",
+		},
+		{
+			"if (x) {\nif (y) { 1 } else {\nreturn 2 } }",
+			"if (x) {\n\tif (y) { 1 } else {\n\t\treturn 2;\n\t}\n}\n",
+		},
+		{
+			"let newAdder = fn(x) { fn(y) { let z = x + y; z } };",
+			"let newAdder = fn(x) {\n\tfn(y) {\n\t\tlet z = x + y;\n\t\tz\n\t}\n};\n",
+		},
+		{"while(i<3){let i=i+1}", "while (i < 3) { let i = i + 1 }\n"},
+		{"x=y+=1", "x = y += 1;\n"},
+		{"let v = a?.b ?.c?[ 0 ]??null", "let v = a?.b?.c?[0] ?? null;\n"},
+		{"(a ?? b) || (c ?? d)", "(a ?? b) || (c ?? d);\n"},
+		{"a ?? (b || c)", "a ?? b || c;\n"},
+		{"(x = 1) + 2", "(x = 1) + 2;\n"},
+		{"xs[i*2]/=(a||b)", "xs[i * 2] /= a || b;\n"},
+		{"if (x) { 1 }; [xs][0] = 2", "if (x) { 1 };\n[xs][0] = 2;\n"},
+		{"for(x in xs){if(x){break}else{continue}};x", "for (x in xs) { if (x) { break } else { continue } }\nx;\n"},
+		{
+			"for (k in {\"a\": 1}) {\nwhile (true) { break }\n}",
+			"for (k in {\"a\": 1}) {\n\twhile (true) { break }\n}\n",
+		},
+		{"try{f()}catch(e){throw e}finally{done()};x", "try { f() } catch (e) { throw e } finally { done() }\nx;\n"},
+		{
+			"try {\nf(); g() } finally { throw   {\"kind\": \"E\"} }",
+			"try {\n\tf();\n\tg()\n} finally { throw {\"kind\": \"E\"} }\n",
+		},
+		// one line bodies end on their brace
+		{`try { throw "e"; } catch (e) { e }`, "try { throw \"e\" } catch (e) { e }\n"},
+		{"let g = fn() { return 1; }", "let g = fn() { return 1 };\n"},
+		// a single blank line between statements is kept
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		// if statements only keep a semicolon when it matters
+		{"if (x) { 1 }; y", "if (x) { 1 }\ny;\n"},
+		{"if (x) { 1 }; (y)", "if (x) { 1 }\ny;\n"},
+		{"if (x) { 1 }; (y + 1) * 2", "if (x) { 1 };\n(y + 1) * 2;\n"},
+		{"if (x) { 1 }; [1][0]", "if (x) { 1 };\n[1][0];\n"},
+		{"if (x) { 1 }; -y", "if (x) { 1 };\n-y;\n"},
+		// lists started on a line of their own stay one item per line
+		{
+			"let config = {\n\"name\": \"monkey\", \"retries\": 3}",
+			"let config = {\n\t\"name\": \"monkey\",\n\t\"retries\": 3\n};\n",
+		},
+		{"let xs = [\n1, [2,\n3]]", "let xs = [\n\t1,\n\t[2, 3]\n];\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", tt.input, err)
+			continue
+		}
+
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+
+		again, err := Source("", got)
+		if err != nil {
+			t.Errorf("formatted %q does not parse: %s", got, err)
+			continue
+		}
+
+		if !bytes.Equal(again, got) {
+			t.Errorf("formatting is not idempotent for %q, got=%q", got, again)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"/* a */ /* b */", "/* a */\n/* b */\n"},
+		{"// adds\nlet add = fn(a,b){a+b}   ", "// adds\nlet add = fn(a, b) { a + b };\n"},
+		{"let x = 5;   // five   \nx", "let x = 5; // five\nx;\n"},
+		{"let x = 5;\n\n\n// then\n\nx\n// done", "let x = 5;\n\n// then\n\nx;\n// done\n"},
+		// a comment in a block spreads it over several lines
+		{
+			"let f = fn(x) { x /* same */ }",
+			"let f = fn(x) {\n\tx /* same */\n};\n",
+		},
+		{
+			"let f = fn(x) {\n// first\nlet y = x; // why\n\n// then\ny\n// dangling\n}",
+			"let f = fn(x) {\n\t// first\n\tlet y = x; // why\n\n\t// then\n\ty\n\t// dangling\n};\n",
+		},
+		{"if (x) { /* nothing */ }", "if (x) {\n\t/* nothing */\n}\n"},
+		{
+			"let config = {\n// who\n\"name\": \"monkey\", // trailing\n\"retries\": 3 // last\n// end\n}",
+			"let config = {\n\t// who\n\t\"name\": \"monkey\", // trailing\n\t\"retries\": 3 // last\n\t// end\n};\n",
+		},
+		// comments inside single line expressions end up after them
+		{"add(1, /* two */ 2); // sum", "add(1, 2); /* two */ // sum\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", tt.input, err)
+			continue
+		}
+
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+
+		again, err := Source("", got)
+		if err != nil {
+			t.Errorf("formatted %q does not parse: %s", got, err)
+			continue
+		}
+
+		if !bytes.Equal(again, got) {
+			t.Errorf("formatting is not idempotent for %q, got=%q", got, again)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("script.mk", []byte("let = 5;"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "script.mk:1:5") {
+		t.Errorf("expected error to have a position, got=%q", err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	// nodes built by hand have no positions to go by
+	exp := &ast.InfixExpression{
+		Token:    token.Token{Type: token.ASTERISK, Literal: "*"},
+		Operator: "*",
+		Left: &ast.InfixExpression{
+			Token:    token.Token{Type: token.PLUS, Literal: "+"},
+			Operator: "+",
+			Left:     &ast.Identifier{Value: "a"},
+			Right:    &ast.Identifier{Value: "b"},
+		},
+		Right: &ast.Identifier{Value: "c"},
+	}
+
+	var buf bytes.Buffer
+	if err := Node(&buf, exp); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "(a + b) * c" {
+		t.Errorf("expected %q, got=%q", "(a + b) * c", buf.String())
+	}
+}
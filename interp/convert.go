@@ -0,0 +1,588 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"github.com/cijin/go-interpreter/evaluator"
+	"github.com/cijin/go-interpreter/object"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+/*
+FromGo converts a go value in to an object:
+
+	nil, nil pointers, slices & maps   null
+	bool                               BOOLEAN
+	ints, uints & *big.Int             INTEGER
+	floats                             FLOAT
+	string                             STRING
+	slices & arrays                    ARRAY
+	maps                               HASH, with the keys in sorted order
+	funcs                              BUILTIN
+	object.Object                      itself
+
+Pointers are followed. A func's arguments are converted to its parameter
+types when it is called, an error it returns as its last result is raised
+in the script. Several other results are returned as an array.
+*/
+func FromGo(v interface{}) (object.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return object.NULL, nil
+
+	case object.Object:
+		return v, nil
+
+	case *big.Int:
+		if v == nil {
+			return object.NULL, nil
+		}
+
+		return object.NewInteger(new(big.Int).Set(v)), nil
+	}
+
+	return fromValue(reflect.ValueOf(v))
+}
+
+func fromValue(v reflect.Value) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return object.TRUE, nil
+		}
+
+		return object.FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return object.NewInteger(new(big.Int).SetUint64(v.Uint())), nil
+		}
+
+		return &object.Integer{Value: int64(v.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return object.NULL, nil
+		}
+
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := FromGo(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			elements[i] = el
+		}
+
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+
+		return fromMap(v)
+
+	case reflect.Func:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+
+		return wrapFunc(v), nil
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+
+		return FromGo(v.Elem().Interface())
+
+	default:
+		return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+	}
+}
+
+// go maps have no order, so the pairs are sorted by key to give the hash
+// the same order every time
+func fromMap(v reflect.Value) (object.Object, error) {
+	pairs := make([]object.HashPair, 0, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := FromGo(iter.Key().Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := FromGo(iter.Value().Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, object.HashPair{Key: key, Value: value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, aok := pairs[i].Key.(*object.Integer)
+		b, bok := pairs[j].Key.(*object.Integer)
+		if aok && bok {
+			return a.Value < b.Value
+		}
+
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+
+	hash := object.NewHash()
+	for _, pair := range pairs {
+		key, ok := pair.Key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", pair.Key.Type())
+		}
+
+		hash.Set(key, pair.Value)
+	}
+
+	return hash, nil
+}
+
+/*
+ToGo converts an object in to a go value, the reverse of FromGo:
+
+	null       nil
+	BOOLEAN    bool
+	INTEGER    int64, or *big.Int when it doesn't fit
+	FLOAT      float64
+	STRING     string
+	ARRAY      []interface{}
+	HASH       map[string]interface{} if every key is a string,
+	           map[interface{}]interface{} otherwise
+
+Anything else, like functions, is returned as is. An array or hash inside
+itself, which assigning to an index can do, is converted to the string
+"[...]" or "{...}" where it repeats, as go values made of interface{}s
+can't be printed or compared once they hold themselves.
+*/
+func ToGo(obj object.Object) interface{} {
+	return toGo(obj, make(map[object.Object]bool))
+}
+
+// seen are the arrays & hashes being converted further out
+func toGo(obj object.Object, seen map[object.Object]bool) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+
+	case *object.Boolean:
+		return obj.Value
+
+	case *object.Integer:
+		return obj.Value
+
+	case *object.BigInt:
+		return new(big.Int).Set(obj.Value)
+
+	case *object.Float:
+		return obj.Value
+
+	case *object.String:
+		return obj.Value
+
+	case *object.Array:
+		if seen[obj] {
+			return "[...]"
+		}
+
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = toGo(el, seen)
+		}
+
+		return elements
+
+	case *object.Hash:
+		if seen[obj] {
+			return "{...}"
+		}
+
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		return hashToGo(obj, seen)
+
+	default:
+		return obj
+	}
+}
+
+func hashToGo(hash *object.Hash, seen map[object.Object]bool) interface{} {
+	strings := make(map[string]interface{}, hash.Len())
+	for _, pair := range hash.Pairs() {
+		key, ok := pair.Key.(*object.String)
+		if !ok {
+			break
+		}
+
+		strings[key.Value] = toGo(pair.Value, seen)
+	}
+
+	if len(strings) == hash.Len() {
+		return strings
+	}
+
+	m := make(map[interface{}]interface{}, hash.Len())
+	for _, pair := range hash.Pairs() {
+		m[toGo(pair.Key, seen)] = toGo(pair.Value, seen)
+	}
+
+	return m
+}
+
+// toValue converts obj to a go value of type t, for the arguments of
+// funcs. It reports false if obj can't be one.
+func toValue(obj object.Object, t reflect.Type) (reflect.Value, bool) {
+	if obj == object.NULL {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), true
+		}
+	}
+
+	if t.Kind() == reflect.Interface {
+		// object.Object parameters get the object itself
+		if t.NumMethod() > 0 {
+			if reflect.TypeOf(obj).Implements(t) {
+				return reflect.ValueOf(obj), true
+			}
+
+			return reflect.Value{}, false
+		}
+
+		return reflect.ValueOf(ToGo(obj)), true
+	}
+
+	if t == bigIntType {
+		value, ok := object.BigValue(obj)
+		return reflect.ValueOf(value), ok
+	}
+
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return v, false
+		}
+
+		v.SetBool(b.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok || v.OverflowInt(i.Value) {
+			return v, false
+		}
+
+		v.SetInt(i.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok || i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return v, false
+		}
+
+		v.SetUint(uint64(i.Value))
+
+	// integers are promoted to floats, like they are in arithmetic
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *object.Float:
+			v.SetFloat(n.Value)
+		case *object.Integer:
+			v.SetFloat(float64(n.Value))
+		default:
+			return v, false
+		}
+
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return v, false
+		}
+
+		v.SetString(s.Value)
+
+	case reflect.Slice:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return v, false
+		}
+
+		v.Set(reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements)))
+		for i, el := range arr.Elements {
+			elem, ok := toValue(el, t.Elem())
+			if !ok {
+				return v, false
+			}
+
+			v.Index(i).Set(elem)
+		}
+
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return v, false
+		}
+
+		v.Set(reflect.MakeMapWithSize(t, hash.Len()))
+		for _, pair := range hash.Pairs() {
+			key, ok := toValue(pair.Key, t.Key())
+			if !ok {
+				return v, false
+			}
+
+			value, ok := toValue(pair.Value, t.Elem())
+			if !ok {
+				return v, false
+			}
+
+			v.SetMapIndex(key, value)
+		}
+
+	case reflect.Func:
+		if obj.Type() != object.FUNCTION_OBJ && obj.Type() != object.BUILTIN_OBJ {
+			return v, false
+		}
+
+		return callbackFunc(obj, t), true
+
+	default:
+		return v, false
+	}
+
+	return v, true
+}
+
+// wrapFunc turns a go func in to a builtin
+func wrapFunc(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		numIn := t.NumIn()
+
+		if t.IsVariadic() && len(args) < numIn-1 {
+			return &object.Error{
+				Kind:    object.ARGUMENT_ERROR,
+				Message: fmt.Sprintf("wrong number of arguments: want at least %d, got=%d", numIn-1, len(args)),
+			}
+		}
+
+		if !t.IsVariadic() && len(args) != numIn {
+			return &object.Error{
+				Kind:    object.ARGUMENT_ERROR,
+				Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d", numIn, len(args)),
+			}
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			param := t.In(min(i, numIn-1))
+			if t.IsVariadic() && i >= numIn-1 {
+				param = param.Elem()
+			}
+
+			v, ok := toValue(arg, param)
+			if !ok {
+				return &object.Error{
+					Kind:    object.TYPE_ERROR,
+					Message: fmt.Sprintf("cannot use %s as %s in argument %d", arg.Type(), param, i+1),
+				}
+			}
+
+			in[i] = v
+		}
+
+		return call(fn, in)
+	}}
+}
+
+// call calls a go func, turning a panic in to an error so it stays in the
+// script. Script functions passed as callbacks panic with their errors when
+// the callback has no error result to return them in.
+func call(fn reflect.Value, in []reflect.Value) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				result = hostError(err)
+				return
+			}
+
+			result = &object.Error{Kind: object.RUNTIME_ERROR, Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	return fromResults(fn.Call(in))
+}
+
+// signature describes the parameters of a go func by the types toValue
+// converts from, so registered funcs report bad arguments like builtins do
+func signature(t reflect.Type) *object.Signature {
+	sig := &object.Signature{Variadic: t.IsVariadic()}
+
+	for i := 0; i < t.NumIn(); i++ {
+		param := t.In(i)
+		if sig.Variadic && i == t.NumIn()-1 {
+			param = param.Elem()
+		}
+
+		sig.Params = append(sig.Params, paramTypes(param))
+	}
+
+	return sig
+}
+
+func paramTypes(t reflect.Type) object.Types {
+	var types object.Types
+
+	switch t.Kind() {
+	case reflect.Bool:
+		types = object.Types{object.BOOLEAN_OBJ}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		types = object.Types{object.INTEGER_OBJ}
+
+	case reflect.Float32, reflect.Float64:
+		types = object.Types{object.FLOAT_OBJ, object.INTEGER_OBJ}
+
+	case reflect.String:
+		types = object.Types{object.STRING_OBJ}
+
+	case reflect.Slice:
+		types = object.Types{object.ARRAY_OBJ, object.NULL_OBJ}
+
+	case reflect.Map:
+		types = object.Types{object.HASH_OBJ, object.NULL_OBJ}
+
+	case reflect.Func:
+		types = object.Types{object.FUNCTION_OBJ, object.BUILTIN_OBJ, object.NULL_OBJ}
+
+	case reflect.Pointer:
+		if t == bigIntType {
+			types = object.Types{object.INTEGER_OBJ}
+		}
+	}
+
+	// anything else is left to toValue
+	return types
+}
+
+func fromResults(out []reflect.Value) object.Object {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return hostError(err)
+		}
+
+		out = out[:n-1]
+	}
+
+	if len(out) == 0 {
+		return object.NULL
+	}
+
+	results := make([]object.Object, len(out))
+	for i, v := range out {
+		obj, err := FromGo(v.Interface())
+		if err != nil {
+			return hostError(err)
+		}
+
+		results[i] = obj
+	}
+
+	if len(results) == 1 {
+		return results[0]
+	}
+
+	return &object.Array{Elements: results}
+}
+
+// errors from the host are runtime errors, unless they already are errors
+// of the interpreter
+func hostError(err error) *object.Error {
+	if err, ok := err.(*object.Error); ok {
+		return err
+	}
+
+	return &object.Error{Kind: object.RUNTIME_ERROR, Message: err.Error()}
+}
+
+/*
+callbackFunc turns a script function in to a go func of type t, so script
+functions can be passed to funcs that take callbacks. Errors, raised in the
+script or converting values, are returned if t's last result is an error
+and panic otherwise, for the builtin the func was passed to to recover.
+*/
+func callbackFunc(fn object.Object, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+
+		fail := func(err error) []reflect.Value {
+			if len(out) == 0 || t.Out(len(out)-1) != errorType {
+				panic(err)
+			}
+
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		args := make([]object.Object, len(in))
+		for i, v := range in {
+			arg, err := FromGo(v.Interface())
+			if err != nil {
+				return fail(err)
+			}
+
+			args[i] = arg
+		}
+
+		result := evaluator.Apply(fn, args...)
+		if err, ok := result.(*object.Error); ok {
+			return fail(err)
+		}
+
+		if len(out) > 0 && t.Out(0) != errorType {
+			v, ok := toValue(result, t.Out(0))
+			if !ok {
+				return fail(fmt.Errorf("cannot use %s as %s", result.Type(), t.Out(0)))
+			}
+
+			out[0] = v
+		}
+
+		return out
+	})
+}
@@ -0,0 +1,168 @@
+/*
+Package interp embeds the interpreter in go programs. An Interpreter keeps
+its globals from one call to the next, and converts values between go and
+the interpreter on the way in & out, see FromGo and ToGo.
+
+	in := interp.New()
+	in.Register("double", func(n int) int { return n * 2 })
+
+	if _, err := in.Eval(`let quadruple = fn(n) { double(double(n)) }`); err != nil {
+		return err
+	}
+
+	n, err := in.Call("quadruple", 3) // int64(12)
+*/
+package interp
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/cijin/go-interpreter/ast"
+	"github.com/cijin/go-interpreter/evaluator"
+	"github.com/cijin/go-interpreter/lexer"
+	"github.com/cijin/go-interpreter/object"
+	"github.com/cijin/go-interpreter/parser"
+)
+
+type Interpreter struct {
+	env      *object.Enviornment
+	builtins *object.BuiltinRegistry
+	limits   object.Limits
+
+	// calls to Eval & Call in progress, registered functions can make
+	// them while a script runs
+	running int
+}
+
+// New returns an interpreter with nothing but the builtins defined
+func New() *Interpreter {
+	in := &Interpreter{env: object.NewEnviornment(), builtins: object.Builtins.Clone()}
+	in.env.SetBuiltins(in.builtins)
+
+	return in
+}
+
+// ParseError holds every error the parser found, one per line
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string { return strings.Join(e.Errors, "\n") }
+
+// Eval runs src, returning the value of its last expression statement.
+// Parse errors are returned as *ParseError, runtime errors as
+// *object.Error.
+func (in *Interpreter) Eval(src string) (interface{}, error) {
+	p := parser.New(lexer.New(src))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	defer in.enter()()
+
+	return result(evaluator.Eval(program, in.env))
+}
+
+// Call calls the function bound to name, a function defined by a script or
+// one registered by the host
+func (in *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	defer in.enter()()
+
+	// looked up like an identifier in a script, so builtins can be called
+	fn := evaluator.Eval(&ast.Identifier{Value: name}, in.env)
+	if err, ok := fn.(*object.Error); ok {
+		return nil, err
+	}
+
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := FromGo(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		objs[i] = obj
+	}
+
+	return result(evaluator.Apply(fn, objs...))
+}
+
+// enter starts a call to Eval or Call, returning the func that ends it. The
+// limits start over for calls from the host, calls made by registered
+// functions while a script runs are part of that script's run and count
+// against what is left of its limits.
+func (in *Interpreter) enter() func() {
+	if in.running == 0 {
+		in.env.SetLimits(in.limits)
+	}
+
+	in.running++
+
+	return func() { in.running-- }
+}
+
+// SetOutput sends what scripts print with puts to w rather than standard
+// output
+func (in *Interpreter) SetOutput(w io.Writer) {
+	in.builtins.SetOutput(w)
+}
+
+// SetLimits bounds what each later call to Eval or Call may use, see
+// object.Limits
+func (in *Interpreter) SetLimits(l object.Limits) {
+	in.limits = l
+}
+
+// Get returns the value of a global, reporting false if it isn't bound
+func (in *Interpreter) Get(name string) (interface{}, bool) {
+	obj, ok := in.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+
+	return ToGo(obj), true
+}
+
+// Set binds a global to v, replacing whatever it was bound to unless that
+// is a constant
+func (in *Interpreter) Set(name string, v interface{}) error {
+	if pos, ok := in.env.Const(name, false); ok {
+		return fmt.Errorf("cannot assign to const %s (declared at %s)", name, pos)
+	}
+
+	obj, err := FromGo(v)
+	if err != nil {
+		return err
+	}
+
+	in.env.Set(name, obj)
+
+	return nil
+}
+
+// Register makes the go function fn a builtin of this interpreter, replacing
+// a builtin of the same name. Like other builtins it goes in a namespace
+// when name is "ns.name".
+func (in *Interpreter) Register(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("cannot register %T as %s, expected a function", fn, name)
+	}
+
+	in.builtins.Register(name, signature(v.Type()), wrapFunc(v).Fn)
+
+	return nil
+}
+
+func result(obj object.Object) (interface{}, error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, err
+	}
+
+	return ToGo(obj), nil
+}
@@ -0,0 +1,384 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cijin/go-interpreter/object"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"null", nil},
+		{"let x = 1;", nil},
+		{"[1, [true, \"a\"]]", []interface{}{int64(1), []interface{}{true, "a"}}},
+		{`{"a": 1, "b": [2]}`, map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2)}}},
+		{`{1: "a", "b": 2}`, map[interface{}]interface{}{int64(1): "a", "b": int64(2)}},
+		{"9223372036854775807 + 1", new(big.Int).Lsh(big.NewInt(1), 63)},
+	}
+
+	for _, tt := range tests {
+		got, err := New().Eval(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval("let = 1; let y 2;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected *ParseError, got=%T (%v)", err, err)
+	}
+
+	if len(parseErr.Errors) < 2 || err.Error() != strings.Join(parseErr.Errors, "\n") {
+		t.Errorf("expected every error, one per line, got=%q", err.Error())
+	}
+
+	_, err = in.Eval("let f = fn() { 1 / 0 };\nf()")
+	var runtimeErr *object.Error
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *object.Error, got=%T (%v)", err, err)
+	}
+
+	expected := "1:16: ArithmeticError: division by zero\n\tin f, called at 2:1"
+	if runtimeErr.Traceback() != expected {
+		t.Errorf("expected traceback %q, got=%q", expected, runtimeErr.Traceback())
+	}
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	in := New()
+
+	if _, err := in.Eval("let count = 1; const limit = 3;"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := in.Eval("count += 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := in.Get("count"); !ok || got != int64(2) {
+		t.Errorf("expected count to be 2, got=%#v (%t)", got, ok)
+	}
+
+	if _, ok := in.Get("missing"); ok {
+		t.Errorf("expected missing to be unbound")
+	}
+
+	if err := in.Set("name", "go"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := in.Eval(`name + "!"`); err != nil || got != "go!" {
+		t.Errorf(`expected "go!", got=%#v (%v)`, got, err)
+	}
+
+	if err := in.Set("limit", 4); err == nil || err.Error() != "cannot assign to const limit (declared at 1:16)" {
+		t.Errorf("expected const error, got=%v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New()
+
+	if _, err := in.Eval("let add = fn(a, b) { a + b }; let first = fn(xs) { xs[0] };"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected interface{}
+	}{
+		{"add", []interface{}{1, 2}, int64(3)},
+		{"add", []interface{}{uint8(1), 0.5}, 1.5},
+		{"add", []interface{}{"a", "b"}, "ab"},
+		{"first", []interface{}{[]string{"x", "y"}}, "x"},
+		{"first", []interface{}{[2]bool{true, false}}, true},
+		{"len", []interface{}{map[string]int{"a": 1, "b": 2}}, int64(2)},
+	}
+
+	for _, tt := range tests {
+		got, err := in.Call(tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s%v: unexpected error: %s", tt.name, tt.args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s%v: expected %#v, got=%#v", tt.name, tt.args, tt.expected, got)
+		}
+	}
+
+	errorTests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"missing", nil, "identifier is undefined: missing"},
+		{"add", []interface{}{1}, "wrong number of arguments: want=2, got=1"},
+		{"add", []interface{}{1, struct{}{}}, "cannot convert struct {} to an object"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := in.Call(tt.name, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s%v: expected error %q, got=%v", tt.name, tt.args, tt.expected, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	in := New()
+
+	register := map[string]interface{}{
+		"double": func(n int) int { return n * 2 },
+		"sum": func(ns ...float64) float64 {
+			total := 0.0
+			for _, n := range ns {
+				total += n
+			}
+			return total
+		},
+		"join":   func(parts []string, sep string) string { return strings.Join(parts, sep) },
+		"keys":   func(m map[string]int) int { return len(m) },
+		"divmod": func(a, b int) (int, int) { return a / b, a % b },
+		"check": func(ok bool) error {
+			if !ok {
+				return errors.New("check failed")
+			}
+			return nil
+		},
+		"apply": func(f func(int) int, n int) int { return f(n) },
+		"each": func(xs []int, f func(int)) {
+			for _, x := range xs {
+				f(x)
+			}
+		},
+		"crash":         func() { panic("boom") },
+		"attempt":       func(f func() (int, error)) (int, error) { return f() },
+		"raw":           func(obj object.Object) string { return string(obj.Type()) },
+		"len":           func(s string) string { return "shadowed" },
+		"strings.upper": strings.ToUpper,
+	}
+
+	for name, fn := range register {
+		if err := in.Register(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"double(21)", int64(42)},
+		{"sum()", 0.0},
+		{"sum(1, 2.5)", 3.5},
+		{`join(["a", "b"], "-")`, "a-b"},
+		{`keys({"a": 1, "b": 2})`, int64(2)},
+		{"divmod(7, 2)", []interface{}{int64(3), int64(1)}},
+		{"check(true)", nil},
+		{"apply(fn(n) { n + 1 }, 1)", int64(2)},
+		{"apply(double, 2)", int64(4)},
+		{"raw([])", "ARRAY"},
+		{`len("abc")`, "shadowed"},
+		{`strings["upper"]("abc")`, "ABC"},
+	}
+
+	for _, tt := range tests {
+		got, err := in.Eval(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"double()", "1:1: ArgumentError: wrong number of arguments for double: want=1, got=0"},
+		{`double("a")`, "1:1: TypeError: wrong type of argument 1 for double: want=INTEGER, got=STRING"},
+		{"double(1.5)", "1:1: TypeError: wrong type of argument 1 for double: want=INTEGER, got=FLOAT"},
+		{"double(9223372036854775807 + 1)", "1:1: TypeError: cannot use INTEGER as int in argument 1"},
+		{`join([1], "-")`, "1:1: TypeError: cannot use ARRAY as []string in argument 1"},
+		{`sum(1, "a")`, "1:1: TypeError: wrong type of argument 2 for sum: want=FLOAT or INTEGER, got=STRING"},
+		{"check(false)", "1:1: RuntimeError: check failed"},
+		{`attempt(fn() { "a" })`, "1:1: RuntimeError: cannot use STRING as int"},
+		// errors in callbacks that can't return them, and panics, stay in the script
+		{"each([1, 2], fn(x) { 1 / 0 })", "1:22: ArithmeticError: division by zero\n\tin anonymous function, called by the host"},
+		{`apply(fn(n) { "a" }, 1)`, "1:1: RuntimeError: cannot use STRING as int"},
+		{"crash()", "1:1: RuntimeError: panic: boom"},
+		{"attempt(fn() { 1 / 0 })", "1:16: ArithmeticError: division by zero\n\tin anonymous function, called by the host"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := in.Eval(tt.input)
+		if err == nil {
+			t.Errorf("%s: expected error %q", tt.input, tt.expected)
+			continue
+		}
+
+		if err.(*object.Error).Traceback() != tt.expected {
+			t.Errorf("%s: expected error %q, got=%q", tt.input, tt.expected, err.(*object.Error).Traceback())
+		}
+	}
+
+	// registered functions are private to the interpreter
+	if got, err := New().Eval(`len("abc")`); err != nil || got != int64(3) {
+		t.Errorf("expected builtin len in a new interpreter, got=%#v (%v)", got, err)
+	}
+
+	if err := in.Register("x", 1); err == nil {
+		t.Errorf("expected error registering a non function")
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var out strings.Builder
+
+	in := New()
+	in.SetOutput(&out)
+
+	if _, err := in.Eval(`puts("a", {"b": 1})`); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "a\n{b: 1}\n" {
+		t.Errorf("expected puts to print to the output, got=%q", out.String())
+	}
+}
+
+func TestCatchHostErrors(t *testing.T) {
+	in := New()
+
+	in.Register("fail", func() error { return errors.New("host failure") })
+
+	got, err := in.Eval(`let f = fn() { try { fail() } catch (e) { return e["kind"] + ": " + e["message"] } }; f()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "RuntimeError: host failure" {
+		t.Errorf("expected caught host error, got=%#v", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	in := New()
+	in.SetLimits(object.Limits{MaxSteps: 1000})
+
+	if _, err := in.Eval("let spin = fn() { while (true) {} };"); err != nil {
+		t.Fatal(err)
+	}
+
+	// every call gets the full budget
+	for i := 0; i < 2; i++ {
+		_, err := in.Call("spin")
+		if err == nil || err.(*object.Error).Kind != object.LIMIT_ERROR {
+			t.Fatalf("expected a LimitError, got=%v", err)
+		}
+
+		if got, err := in.Eval("1 + 1"); err != nil || got != int64(2) {
+			t.Fatalf("expected 2, got=%#v (%v)", got, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in.SetLimits(object.Limits{Context: ctx})
+	in.Register("cancel", cancel)
+
+	_, err := in.Eval("cancel(); spin()")
+	if err == nil || err.Error() != "1:11: evaluation stopped: context canceled" {
+		t.Errorf("expected the evaluation to stop, got=%v", err)
+	}
+}
+
+func TestToGoCyclic(t *testing.T) {
+	got, err := New().Eval(`let a = [1, 2]; let h = {"a": a}; a[0] = h; a[1] = a; h["h"] = h; a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{"a": "[...]", "h": "{...}"},
+		"[...]",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got=%#v", expected, got)
+	}
+}
+
+// registered functions calling back in to the interpreter don't start the
+// limits over
+func TestLimitsReentrant(t *testing.T) {
+	tests := []struct {
+		limits   object.Limits
+		expected string
+	}{
+		{object.Limits{MaxSteps: 1000}, "LimitError: evaluation exceeded 1000 steps"},
+		{object.Limits{MaxDepth: 50}, "RuntimeError: stack overflow"},
+	}
+
+	for _, tt := range tests {
+		in := New()
+		in.SetLimits(tt.limits)
+
+		in.Register("again", func(n int) (interface{}, error) { return in.Call("f", n) })
+		if _, err := in.Eval("let f = fn(n) { if (n > 0) { again(n - 1) } else { 0 } };"); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := in.Call("f", 5000)
+		if err == nil {
+			t.Errorf("%+v: expected error %q", tt.limits, tt.expected)
+			continue
+		}
+
+		if got := err.(*object.Error); string(got.Kind)+": "+got.Message != tt.expected {
+			t.Errorf("%+v: expected error %q, got=%q", tt.limits, tt.expected, string(got.Kind)+": "+got.Message)
+		}
+
+		// the next call from the host starts over
+		if got, err := in.Call("f", 10); err != nil || got != int64(0) {
+			t.Errorf("%+v: expected 0, got=%#v (%v)", tt.limits, got, err)
+		}
+	}
+}
+
+func TestFromGoHashOrder(t *testing.T) {
+	obj, err := FromGo(map[int]string{3: "c", 1: "a", 2: "b", -1: "z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "{-1: z, 1: a, 2: b, 3: c}"
+	if obj.Inspect() != expected {
+		t.Errorf("expected %s, got=%s", expected, obj.Inspect())
+	}
+}
@@ -1,35 +1,95 @@
 package lexer
 
 import (
-	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/cijin/go-interpreter/token"
 )
 
+// Error is a problem the lexer found with a token, Pos is where exactly,
+// which for a bad escape is somewhere inside the string
+type Error struct {
+	Pos token.Position
+	Msg string
+
+	// EOF is set when the token ran into the end of input, so more input
+	// could still complete it
+	EOF bool
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
 type Lexer struct {
+	filename     string
 	input        string
 	ch           byte
 	position     int
 	readPosition int
+	line         int
+	lineStart    int // offset of the first character on the current line
+
+	keepComments bool
+
+	// one entry per interpolation being lexed, counting the braces opened
+	// inside it so the '}' closing it can be told apart
+	interpolations []int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile is like New, but every token position also carries the filename
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+/*
+KeepComments makes NextToken return comments as COMMENT tokens, for tools
+like the formatter that need to put them back. By default comments are
+skipped like whitespace, except for an unterminated block comment which is
+always returned so its error isn't lost.
+*/
+func (l *Lexer) KeepComments() {
+	l.keepComments = true
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII code for null
-	} else {
-		l.ch = l.input[l.readPosition]
+
+		// stay put at the end of input, so EOF has a stable position
+		l.position = len(l.input)
+		l.readPosition = len(l.input) + 1
+		return
 	}
 
+	l.ch = l.input[l.readPosition]
 	l.position = l.readPosition
 	l.readPosition += 1
 }
 
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.position - l.lineStart + 1,
+	}
+}
+
 func (l *Lexer) peakChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -44,67 +104,305 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) readString() (string, error) {
-	// current position on '"'
+/*
+readString reads a double quoted string, decoding escape sequences as it
+goes. A bad escape doesn't stop it, the rest of the string is still read so
+lexing carries on after the closing quote.
+
+The string also ends at "${", which starts an interpolation. It is then
+returned as the open type and the rest of the string is read once the
+matching '}' is found, the closing quote ends that part as the end type.
+*/
+func (l *Lexer) readString(end, open token.TokenType) (string, token.TokenType, error) {
+	// current position on '"' or the '}' ending an interpolation
+	start := l.pos()
+
+	var out strings.Builder
+	var err error
+
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == 0:
+			return "", end, &Error{Pos: start, Msg: "string literal not terminated", EOF: true}
+
+		case l.ch == '\n':
+			return "", end, &Error{Pos: start, Msg: "string literal not terminated"}
+
+		case l.ch == '"':
+			return out.String(), end, err
+
+		case l.ch == '$' && l.peakChar() == '{':
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+
+			return out.String(), open, err
+
+		case l.ch == '\\':
+			if e := l.readEscape(&out); e != nil && err == nil {
+				err = e
+			}
+
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+/*
+readEscape decodes the escape sequence starting at the current '\\'. It
+never reads past a newline or the end of input, those are left for
+readString to report.
+
+	\" \\ \n \t \r    the usual
+	\$               a '$', so "\${" isn't an interpolation
+	\xHH             a single byte
+	\u{XXXX}         a unicode code point, 1 to 6 hex digits
+*/
+func (l *Lexer) readEscape(out *strings.Builder) error {
+	pos := l.pos()
+
+	if next := l.peakChar(); next == 0 || next == '\n' {
+		return nil
+	}
+
+	l.readChar()
+
+	switch l.ch {
+	case '"', '\\', '$':
+		out.WriteByte(l.ch)
+
+	case 'n':
+		out.WriteByte('\n')
+
+	case 't':
+		out.WriteByte('\t')
+
+	case 'r':
+		out.WriteByte('\r')
+
+	case 'x':
+		var b byte
+		for i := 0; i < 2; i++ {
+			if !isHexDigit(l.peakChar()) {
+				return l.escapeError(pos, "expected 2 hex digits")
+			}
+
+			l.readChar()
+			b = b*16 + hexValue(l.ch)
+		}
+
+		out.WriteByte(b)
+
+	case 'u':
+		if l.peakChar() != '{' {
+			return l.escapeError(pos, "expected \\u{XXXX}")
+		}
+		l.readChar()
+
+		var r rune
+		digits := 0
+		for isHexDigit(l.peakChar()) {
+			l.readChar()
+			digits += 1
+
+			if digits <= 6 {
+				r = r*16 + rune(hexValue(l.ch))
+			}
+		}
+
+		if l.peakChar() != '}' {
+			return l.escapeError(pos, "expected \\u{XXXX}")
+		}
+		l.readChar()
+
+		if digits == 0 || digits > 6 {
+			return l.escapeError(pos, "expected 1 to 6 hex digits")
+		}
+
+		if r > unicode.MaxRune || 0xD800 <= r && r <= 0xDFFF {
+			return l.escapeError(pos, "not a valid code point")
+		}
+
+		out.WriteRune(r)
+
+	default:
+		r, _ := utf8.DecodeRuneInString(l.input[l.position:])
+		return &Error{Pos: pos, Msg: fmt.Sprintf("unknown escape sequence \\%c", r)}
+	}
+
+	return nil
+}
+
+// escapeError reports the escape sequence from pos up to the current
+// character
+func (l *Lexer) escapeError(pos token.Position, reason string) error {
+	seq := l.input[pos.Offset : l.position+1]
+	return &Error{Pos: pos, Msg: fmt.Sprintf("invalid escape sequence %s, %s", seq, reason)}
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch byte) byte {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
+// raw strings are taken as is and may span lines, only carriage returns
+// are dropped so files with windows line endings read the same
+func (l *Lexer) readRawString() (string, error) {
+	// current position on '`'
+	start := l.pos()
 	position := l.position + 1
 
-	// keep reading till '"'
 	for {
 		l.readChar()
 
-		if l.ch == 0 || l.ch == '\n' {
-			return "", errors.New("string literal not terminated")
+		if l.ch == 0 {
+			return "", &Error{Pos: start, Msg: "raw string literal not terminated", EOF: true}
 		}
 
-		if l.ch == '"' {
+		if l.ch == '`' {
 			break
 		}
+	}
+
+	return strings.ReplaceAll(l.input[position:l.position], "\r", ""), nil
+}
 
-		// escape '"', not sure how to do this yet
-		// also look into \n, \r, \t
-		// if l.ch == '\'
+// reads a comment up to the end of the line, leaving the newline be
+func (l *Lexer) readLineComment() string {
+	position := l.position
+
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
 	}
 
-	return l.input[position:l.position], nil
+	return l.input[position:l.position]
+}
+
+// block comments nest, so a block holding comments can be commented out
+func (l *Lexer) readBlockComment() (string, error) {
+	start := l.pos()
+	position := l.position
+	depth := 0
+
+	for {
+		switch {
+		case l.ch == 0:
+			return l.input[position:l.position], &Error{Pos: start, Msg: "comment not terminated", EOF: true}
+
+		case l.ch == '/' && l.peakChar() == '*':
+			depth += 1
+			l.readChar()
+			l.readChar()
+
+		case l.ch == '*' && l.peakChar() == '/':
+			depth -= 1
+			l.readChar()
+			l.readChar()
+
+			if depth == 0 {
+				return l.input[position:l.position], nil
+			}
+
+		default:
+			l.readChar()
+		}
+	}
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhitespace()
+
+		pos := l.pos()
+		tok := l.readToken()
+		tok.Pos = pos
+		tok.End = l.pos()
+
+		if tok.Type != token.COMMENT || l.keepComments || tok.Error != nil {
+			return tok
+		}
+	}
+}
 
-	l.skipWhitespace()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
 		if l.peakChar() == '=' {
-			ch := l.ch
-			l.readChar()
-
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+			tok = l.twoCharToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 
 	case '!':
 		if l.peakChar() == '=' {
-			ch := l.ch
-			l.readChar()
-
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l.twoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
 
+	case '&':
+		if l.peakChar() == '&' {
+			tok = l.twoCharToken(token.AND)
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+
+	case '|':
+		if l.peakChar() == '|' {
+			tok = l.twoCharToken(token.OR)
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
+
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal, tok.Error = l.readString()
+		tok.Literal, tok.Type, tok.Error = l.readString(token.STRING, token.INTERP_HEAD)
+
+	case '`':
+		tok.Type = token.RAW_STRING
+		tok.Literal, tok.Error = l.readRawString()
 
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peakChar() {
+		case '=':
+			tok = l.twoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.twoCharToken(token.SHL)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peakChar() {
+		case '=':
+			tok = l.twoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.twoCharToken(token.SHR)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
+
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
@@ -112,17 +410,48 @@ func (l *Lexer) NextToken() token.Token {
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peakChar() == '=' {
+			tok = l.twoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peakChar() == '=' {
+			tok = l.twoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peakChar() == '=' {
+			tok = l.twoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		switch l.peakChar() {
+		case '/':
+			tok.Type = token.COMMENT
+			tok.Literal = l.readLineComment()
+			return tok
+
+		case '*':
+			tok.Type = token.COMMENT
+			tok.Literal, tok.Error = l.readBlockComment()
+			return tok
+
+		case '=':
+			tok = l.twoCharToken(token.SLASH_ASSIGN)
+
+		default:
+			tok = newToken(token.SLASH, l.ch)
+		}
 
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
@@ -131,10 +460,46 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1] += 1
+		}
+
 		tok = newToken(token.LSQUIRLY, l.ch)
 
 	case '}':
-		tok = newToken(token.RSQUIRLY, l.ch)
+		n := len(l.interpolations)
+
+		switch {
+		case n > 0 && l.interpolations[n-1] == 0:
+			// closes the interpolation, the string carries on
+			l.interpolations = l.interpolations[:n-1]
+			tok.Literal, tok.Type, tok.Error = l.readString(token.INTERP_TAIL, token.INTERP_MIDDLE)
+
+		case n > 0:
+			l.interpolations[n-1] -= 1
+			tok = newToken(token.RSQUIRLY, l.ch)
+
+		default:
+			tok = newToken(token.RSQUIRLY, l.ch)
+		}
+
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+
+	case '?':
+		switch l.peakChar() {
+		case '?':
+			tok = l.twoCharToken(token.NULLISH)
+		case '.':
+			tok = l.twoCharToken(token.OPTIONAL_DOT)
+		case '[':
+			tok = l.twoCharToken(token.OPTIONAL_LBRACKET)
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 
 	case 0:
 		tok.Literal = ""
@@ -151,8 +516,7 @@ func (l *Lexer) NextToken() token.Token {
 		}
 
 		if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
 
 			return tok
 		}
@@ -168,6 +532,14 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// twoCharToken reads the second character of an operator made of two
+func (l *Lexer) twoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 
@@ -182,14 +554,46 @@ func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
-func (l *Lexer) readNumber() string {
+/*
+readNumber reads an integer, or a float if a fraction or an exponent follows
+the digits. Both need digits after them, so "1.foo" and "2e" lex the number
+and leave the rest be.
+*/
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
 
-	for isDigit(l.ch) {
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peakChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
 	}
 
-	return l.input[position:l.position]
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.readPosition
+		if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+			next += 1
+		}
+
+		if next < len(l.input) && isDigit(l.input[next]) {
+			tokenType = token.FLOAT
+			for l.readPosition < next {
+				l.readChar()
+			}
+			l.readChar()
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) {
+		l.readChar()
+	}
 }
 
 func isDigit(ch byte) bool {
@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/cijin/go-interpreter/token"
@@ -16,7 +17,7 @@ func TestNextToken(t *testing.T) {
 
 	let result = add(five, ten);
 
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 9;
 
 	if (5 < 10) {
@@ -29,6 +30,8 @@ func TestNextToken(t *testing.T) {
 	10 != 9;
 	"foobar"
 	"foo bar"
+	[1, 2];
+	{"foo": "bar"}
 	`
 
 	tests := []struct {
@@ -110,6 +113,17 @@ func TestNextToken(t *testing.T) {
 		{token.SEMICOLON, ";"},
 		{token.STRING, "foobar"},
 		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LSQUIRLY, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RSQUIRLY, "}"},
 		{token.EOF, ""},
 	}
 
@@ -127,3 +141,366 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"ab\"\n"
+
+	tests := []struct {
+		expectedType token.TokenType
+		line, column int
+		offset       int
+		endColumn    int
+	}{
+		{token.LET, 1, 1, 0, 4},
+		{token.IDENT, 1, 5, 4, 6},
+		{token.ASSIGN, 1, 7, 6, 8},
+		{token.INT, 1, 9, 8, 10},
+		{token.SEMICOLON, 1, 10, 9, 11},
+		{token.IDENT, 2, 3, 13, 4},
+		{token.PLUS, 2, 5, 15, 6},
+		{token.STRING, 2, 7, 17, 11},
+		{token.EOF, 3, 1, 22, 1},
+		{token.EOF, 3, 1, 22, 1},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d]: wrong token type. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Filename != "test.mk" {
+			t.Errorf("test[%d]: wrong filename. expected=test.mk, got=%s", i, tok.Pos.Filename)
+		}
+
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Errorf("test[%d]: wrong position. expected=%d:%d, got=%d:%d", i, tt.line, tt.column, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.Offset != tt.offset {
+			t.Errorf("test[%d]: wrong offset. expected=%d, got=%d", i, tt.offset, tok.Pos.Offset)
+		}
+
+		if tok.End.Column != tt.endColumn {
+			t.Errorf("test[%d]: wrong end column. expected=%d, got=%d", i, tt.endColumn, tok.End.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+/* block /* nested */ still comment */ x / 2
+/* not closed`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "/* block /* nested */ still comment */"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.COMMENT, "/* not closed"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	l.KeepComments()
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d]: wrong token. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Type == token.COMMENT && (tok.Error != nil) != (i == 11) {
+			t.Errorf("test[%d]: wrong error, got=%v", i, tok.Error)
+		}
+	}
+
+	// without KeepComments only the unterminated comment shows up
+	l = New(input)
+
+	var types []string
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, string(tok.Type))
+	}
+
+	expected := "LET IDENT = INT ; IDENT / INT COMMENT"
+	if got := strings.Join(types, " "); got != expected {
+		t.Errorf("wrong tokens without comments. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		expectedErr string
+	}{
+		{`"a\"b"`, `a"b`, ""},
+		{`"a\\b"`, `a\b`, ""},
+		{`"\n\t\r"`, "\n\t\r", ""},
+		{`"\x41\x7a\xFF"`, "Az\xff", ""},
+		{`"\u{41}\u{e9}\u{1F600}"`, "Aé😀", ""},
+		{"`raw \\n ${x}\nstring`", "raw \\n ${x}\nstring", ""},
+		{"`a\r\nb`", "a\nb", ""},
+		{`"ab\q"`, "", "1:4: unknown escape sequence \\q"},
+		{`"\x4"`, "", "1:2: invalid escape sequence \\x4, expected 2 hex digits"},
+		{`"\xZZ"`, "", "1:2: invalid escape sequence \\x, expected 2 hex digits"},
+		{`"\u41"`, "", "1:2: invalid escape sequence \\u, expected \\u{XXXX}"},
+		{`"\u{41"`, "", "1:2: invalid escape sequence \\u{41, expected \\u{XXXX}"},
+		{`"\u{}"`, "", "1:2: invalid escape sequence \\u{}, expected 1 to 6 hex digits"},
+		{`"\u{1234567}"`, "", "1:2: invalid escape sequence \\u{1234567}, expected 1 to 6 hex digits"},
+		{`"\u{110000}"`, "", "1:2: invalid escape sequence \\u{110000}, not a valid code point"},
+		{`"\u{D800}"`, "", "1:2: invalid escape sequence \\u{D800}, not a valid code point"},
+		{`"abc\"`, "", "1:1: string literal not terminated"},
+		{"`abc", "", "1:1: raw string literal not terminated"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tt.expectedErr == "" {
+			if tok.Error != nil {
+				t.Errorf("%s: unexpected error %s", tt.input, tok.Error)
+				continue
+			}
+
+			if tok.Literal != tt.expected {
+				t.Errorf("%s: wrong literal. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+			}
+			continue
+		}
+
+		err, ok := tok.Error.(*Error)
+		if !ok {
+			t.Errorf("%s: expected a *Error, got=%T (%v)", tt.input, tok.Error, tok.Error)
+			continue
+		}
+
+		if got := err.Pos.String() + ": " + err.Msg; got != tt.expectedErr {
+			t.Errorf("%s: wrong error. expected=%q, got=%q", tt.input, tt.expectedErr, got)
+		}
+
+		// lexing carries on after the string
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%s: expected EOF after the string, got=%s", tt.input, next.Type)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `a <= b >= c < d > e && f || g % h & i | j ^ ~k << l >> m += n -= o *= p /= q = r`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.AND, "&&"},
+		{token.IDENT, "f"},
+		{token.OR, "||"},
+		{token.IDENT, "g"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "h"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "i"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "j"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENT, "k"},
+		{token.SHL, "<<"},
+		{token.IDENT, "l"},
+		{token.SHR, ">>"},
+		{token.IDENT, "m"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.IDENT, "n"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.IDENT, "o"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.IDENT, "p"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.IDENT, "q"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "r"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d]: wrong token. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := `while for in break continue inside`
+
+	expected := []token.TokenType{token.WHILE, token.FOR, token.IN, token.BREAK, token.CONTINUE, token.IDENT, token.EOF}
+
+	l := New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tt {
+			t.Fatalf("test[%d]: wrong token. expected=%s, got=%s %q", i, tt, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTryKeywords(t *testing.T) {
+	input := `try catch finally throw trying`
+
+	expected := []token.TokenType{token.TRY, token.CATCH, token.FINALLY, token.THROW, token.IDENT, token.EOF}
+
+	l := New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tt {
+			t.Fatalf("test[%d]: wrong token. expected=%s, got=%s %q", i, tt, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNullishOperators(t *testing.T) {
+	input := `a ?? null?.b?[0] ? c`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.NULLISH, "??"},
+		{token.NULL, "null"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		// there is no conditional operator
+		{token.ILLEGAL, "?"},
+		{token.IDENT, "c"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d]: wrong token. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 1.5e3 2E-4 7e+2 1.foo 2e x1.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1.5e3"},
+		{token.FLOAT, "2E-4"},
+		{token.FLOAT, "7e+2"},
+		// a fraction or exponent needs digits
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.INT, "2"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.FLOAT, "1.5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d]: wrong token. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"Hello ${name}, you have ${ {"n": n}["n"] + 1} items" "${"in ${x}"}" "\${no}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_HEAD, "Hello "},
+		{token.IDENT, "name"},
+		{token.INTERP_MIDDLE, ", you have "},
+		{token.LSQUIRLY, "{"},
+		{token.STRING, "n"},
+		{token.COLON, ":"},
+		{token.IDENT, "n"},
+		{token.RSQUIRLY, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "n"},
+		{token.RBRACKET, "]"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.INTERP_TAIL, " items"},
+		// nested
+		{token.INTERP_HEAD, ""},
+		{token.INTERP_HEAD, "in "},
+		{token.IDENT, "x"},
+		{token.INTERP_TAIL, ""},
+		{token.INTERP_TAIL, ""},
+		// escaped
+		{token.STRING, "${no}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d]: wrong token. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Error != nil {
+			t.Fatalf("test[%d]: unexpected error %s", i, tok.Error)
+		}
+	}
+}
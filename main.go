@@ -1,14 +1,323 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/cijin/go-interpreter/ast"
+	"github.com/cijin/go-interpreter/compiler"
+	"github.com/cijin/go-interpreter/evaluator"
+	"github.com/cijin/go-interpreter/format"
+	"github.com/cijin/go-interpreter/lexer"
+	"github.com/cijin/go-interpreter/object"
+	"github.com/cijin/go-interpreter/parser"
 	"github.com/cijin/go-interpreter/repl"
+	"github.com/cijin/go-interpreter/token"
+	"github.com/cijin/go-interpreter/vm"
+)
+
+const usage = `Usage: monkey <command> [arguments]
+
+Commands:
+	run [-engine eval|vm] [-checked] <file> [args...]
+				run a script, args are available to it as the "args" array,
+				-checked makes integers that outgrow 64 bits an error
+	repl			start the interactive repl (default)
+	tokens <file>		print the tokens the lexer produces
+	ast <file>		print the parsed syntax tree
+	check <file>		parse only, exits with a non-zero status on errors
+	fmt [-w] [-d] [files...]
+				format scripts, printing the result unless -w writes it
+				back or -d prints a diff (exiting with status 1 if any)
+`
+
+// exit codes
+const (
+	exitOK = iota
+	exitError
+	exitUsage
 )
 
 func main() {
-	fmt.Print("Welcome to monkey v0.0.1\nPress ctrl-d to exit.\n")
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runRepl(stdin, stdout)
+	}
+
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "repl":
+		return runRepl(stdin, stdout)
+
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+
+	case "fmt":
+		return runFmt(args, stdin, stdout, stderr)
+	}
+
+	engine := "eval"
+	checked := false
+	if cmd == "run" {
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		fs.StringVar(&engine, "engine", engine, "engine to run the script with, eval or vm")
+		fs.BoolVar(&checked, "checked", checked, "report integers that outgrow 64 bits instead of growing them")
+
+		if err := fs.Parse(args); err != nil {
+			return exitUsage
+		}
+
+		if engine != "eval" && engine != "vm" {
+			fmt.Fprintf(stderr, "monkey run: unknown engine %q\n", engine)
+			return exitUsage
+		}
+
+		args = fs.Args()
+	}
+
+	// everything else works on a script file
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, "monkey %s: missing file argument\n\n%s", cmd, usage)
+		return exitUsage
+	}
+
+	filename := args[0]
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey %s: %s\n", cmd, err)
+		return exitError
+	}
+
+	switch cmd {
+	case "run":
+		return runScript(filename, string(src), args[1:], engine, checked, stdout, stderr)
+
+	case "tokens":
+		return runTokens(filename, string(src), stdout, stderr)
+
+	case "ast":
+		return runAst(filename, string(src), stdout, stderr)
+
+	case "check":
+		_, ok := parse(filename, string(src), stderr)
+		if !ok {
+			return exitError
+		}
+
+		return exitOK
+
+	default:
+		fmt.Fprintf(stderr, "monkey: unknown command %q\n\n%s", cmd, usage)
+		return exitUsage
+	}
+}
+
+func runRepl(in io.Reader, out io.Writer) int {
+	fmt.Fprint(out, "Welcome to monkey v0.0.1\nPress ctrl-d to exit.\n")
+
+	repl.Start(in, out)
+
+	return exitOK
+}
+
+// parse prints any parser errors to w and reports whether there were none
+func parse(filename, src string, w io.Writer) (*ast.Program, bool) {
+	p := parser.New(lexer.NewFile(filename, src))
+	program := p.ParseProgram()
+
+	for _, msg := range p.Errors() {
+		fmt.Fprintln(w, msg)
+	}
+
+	return program, len(p.Errors()) == 0
+}
+
+func runScript(filename, src string, scriptArgs []string, engine string, checked bool, stdout, stderr io.Writer) int {
+	program, ok := parse(filename, src, stderr)
+	if !ok {
+		return exitError
+	}
+
+	elements := make([]object.Object, 0, len(scriptArgs))
+	for _, arg := range scriptArgs {
+		elements = append(elements, &object.String{Value: arg})
+	}
+	argsArray := &object.Array{Elements: elements}
+
+	builtins := object.Builtins.Clone()
+	builtins.SetOutput(stdout)
+
+	if engine == "vm" {
+		return runCompiled(program, argsArray, builtins, checked, stderr)
+	}
+
+	env := object.NewEnviornment()
+	env.SetBuiltins(builtins)
+	env.CheckArithmetic(checked)
+	env.Set("args", argsArray)
+
+	evaluated := evaluator.Eval(program, env)
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(stderr, err.Traceback())
+		return exitError
+	}
+
+	return exitOK
+}
+
+func runCompiled(program *ast.Program, argsArray *object.Array, builtins *object.BuiltinRegistry, checked bool, stderr io.Writer) int {
+	symbolTable := compiler.NewSymbolTable()
+	for i, name := range builtins.Names() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	globals := vm.NewGlobalsStore()
+	globals[symbolTable.Define("args").Index] = argsArray
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{}, builtins)
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+	machine.CheckArithmetic(checked)
+	if err := machine.Run(); err != nil {
+		if err, ok := err.(*object.Error); ok {
+			fmt.Fprintln(stderr, err.Traceback())
+			return exitError
+		}
+
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func runTokens(filename, src string, stdout, stderr io.Writer) int {
+	l := lexer.NewFile(filename, src)
+	l.KeepComments()
+	status := exitOK
+
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(stdout, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+
+		if tok.Error != nil {
+			pos := tok.Pos
+			if err, ok := tok.Error.(*lexer.Error); ok {
+				pos = err.Pos
+			}
+
+			fmt.Fprintf(stderr, "%s: %s\n", pos, tok.Error)
+			status = exitError
+		}
+
+		if tok.Type == token.EOF {
+			return status
+		}
+	}
+}
+
+func runAst(filename, src string, stdout, stderr io.Writer) int {
+	program, ok := parse(filename, src, stderr)
+	if !ok {
+		return exitError
+	}
+
+	if err := ast.Dump(stdout, program); err != nil {
+		fmt.Fprintf(stderr, "monkey ast: %s\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+/*
+runFmt formats the given files, or stdin when there are none. By default the
+result is printed, -w writes it back to the file and -d prints a diff
+instead, exiting with an error if any file isn't formatted so it can be used
+as a check.
+*/
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	write := fs.Bool("w", false, "write the result back to the file instead of printing it")
+	showDiff := fs.Bool("d", false, "print a diff instead of the formatted source")
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "monkey fmt: cannot use -w with standard input")
+			return exitUsage
+		}
+
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey fmt: %s\n", err)
+			return exitError
+		}
+
+		return formatFile("<stdin>", src, false, *showDiff, stdout, stderr)
+	}
+
+	status := exitOK
+	for _, filename := range fs.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey fmt: %s\n", err)
+			status = exitError
+			continue
+		}
+
+		if s := formatFile(filename, src, *write, *showDiff, stdout, stderr); s != exitOK {
+			status = s
+		}
+	}
+
+	return status
+}
+
+func formatFile(filename string, src []byte, write, showDiff bool, stdout, stderr io.Writer) int {
+	formatted, err := format.Source(filename, src)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	changed := !bytes.Equal(src, formatted)
+
+	switch {
+	case showDiff:
+		if changed {
+			stdout.Write(diff(filename, src, formatted))
+			return exitError
+		}
+
+	case write:
+		if changed {
+			if err := os.WriteFile(filename, formatted, 0o644); err != nil {
+				fmt.Fprintf(stderr, "monkey fmt: %s\n", err)
+				return exitError
+			}
+		}
+
+	default:
+		stdout.Write(formatted)
+	}
 
-	repl.Start(os.Stdin, os.Stdout)
+	return exitOK
 }
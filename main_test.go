@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(filename, []byte(src), 0o644); err != nil {
+		t.Fatalf("could not write script: %s", err)
+	}
+
+	return filename
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name           string
+		cmd            string
+		src            string
+		extraArgs      []string
+		expectedStatus int
+		expectedOut    string
+		expectedErr    string
+	}{
+		{"check ok", "check", "let x = 5;", nil, exitOK, "", ""},
+		{"check errors", "check", "let = 5;", nil, exitError, "", "script.mk:1:5: expected next token to be IDENT, got ="},
+		{"run ok", "run", "let x = 5; x * 2", nil, exitOK, "", ""},
+		{"run runtime error", "run", "let x = 5;\nx + true", nil, exitError, "", "script.mk:2:1: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{"run parse error", "run", "let x 5", nil, exitError, "", "expected next token to be =, got INT"},
+		{"run args", "run", `if (len(args) != 2) { 1 + true }; if (args[1] != "b") { 1 + true }`, []string{"a", "b"}, exitOK, "", ""},
+		{"tokens", "tokens", "let x", nil, exitOK, "script.mk:1:1\tLET\t\"let\"\nscript.mk:1:5\tIDENT\t\"x\"\nscript.mk:1:6\tEOF\t\"\"\n", ""},
+		{"tokens comments", "tokens", "x // y", nil, exitOK, "script.mk:1:3\tCOMMENT\t\"// y\"\n", ""},
+		{"tokens error", "tokens", `"abc`, nil, exitError, "", "script.mk:1:1: string literal not terminated"},
+		{"ast", "ast", "x", nil, exitOK, "Program script.mk:1:1-script.mk:1:2", ""},
+		{"fmt", "fmt", "let x=5", nil, exitOK, "let x = 5;\n", ""},
+		{"fmt parse error", "fmt", "let = 5", nil, exitError, "", "script.mk:1:5: expected next token to be IDENT"},
+		{"unknown", "frobnicate", "x", nil, exitUsage, "", "unknown command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeScript(t, tt.src)
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{tt.cmd, filename}, tt.extraArgs...)
+			status := run(args, strings.NewReader(""), &stdout, &stderr)
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d, got=%d (stderr: %s)", tt.expectedStatus, status, stderr.String())
+			}
+
+			out := strings.ReplaceAll(stdout.String(), filename, "script.mk")
+			if !strings.Contains(out, tt.expectedOut) {
+				t.Errorf("expected stdout to contain %q, got=%q", tt.expectedOut, out)
+			}
+
+			errOut := strings.ReplaceAll(stderr.String(), filename, "script.mk")
+			if !strings.Contains(errOut, tt.expectedErr) {
+				t.Errorf("expected stderr to contain %q, got=%q", tt.expectedErr, errOut)
+			}
+		})
+	}
+}
+
+func TestMissingFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"run"}, strings.NewReader(""), &stdout, &stderr)
+	if status != exitUsage {
+		t.Errorf("expected status %d, got=%d", exitUsage, status)
+	}
+
+	status = run([]string{"run", filepath.Join(t.TempDir(), "missing.mk")}, strings.NewReader(""), &stdout, &stderr)
+	if status != exitError {
+		t.Errorf("expected status %d, got=%d", exitError, status)
+	}
+}
+
+func TestRunEngines(t *testing.T) {
+	tests := []struct {
+		flags          []string
+		src            string
+		args           []string
+		expectedStatus int
+		expectedErr    string
+	}{
+		{nil, "let x = 5; x * 2", nil, exitOK, ""},
+		{nil, `if (args[0] != "a") { 1 + true }`, []string{"a"}, exitOK, ""},
+		{nil, "let f = fn(x) {\n  x + true\n};\nf(1)", nil, exitError, "script.mk:2:3: TypeError: type mismatch: INTEGER + BOOLEAN\n\tin f, called at script.mk:4:1\n"},
+		{nil, "let x = 0;\n10 / x", nil, exitError, "script.mk:2:1: ArithmeticError: division by zero"},
+		{nil, "9223372036854775807 + 1", nil, exitOK, ""},
+		{[]string{"-checked"}, "let f = fn(x) { x * 2 };\nf(9223372036854775807)", nil, exitError, "script.mk:1:17: ArithmeticError: integer overflow: 9223372036854775807 * 2\n\tin f, called at script.mk:2:1\n"},
+	}
+
+	for _, engine := range []string{"eval", "vm"} {
+		for _, tt := range tests {
+			filename := writeScript(t, tt.src)
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"run", "-engine", engine}, tt.flags...)
+			args = append(append(args, filename), tt.args...)
+			status := run(args, strings.NewReader(""), &stdout, &stderr)
+
+			if status != tt.expectedStatus {
+				t.Errorf("[%s] expected status %d, got=%d (stderr: %s)", engine, tt.expectedStatus, status, stderr.String())
+			}
+
+			errOut := strings.ReplaceAll(stderr.String(), filename, "script.mk")
+			if !strings.Contains(errOut, tt.expectedErr) {
+				t.Errorf("[%s] expected stderr to contain %q, got=%q", engine, tt.expectedErr, errOut)
+			}
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"run", "-engine", "jit", "x.mk"}, strings.NewReader(""), &stdout, &stderr); status != exitUsage {
+		t.Errorf("expected unknown engine to exit with %d, got=%d", exitUsage, status)
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	filename := writeScript(t, `puts("a", [1]); let f = fn() { puts(2) }; f()`)
+
+	for _, engine := range []string{"eval", "vm"} {
+		var stdout, stderr bytes.Buffer
+		status := run([]string{"run", "-engine", engine, filename}, strings.NewReader(""), &stdout, &stderr)
+
+		if status != exitOK || stdout.String() != "a\n[1]\n2\n" {
+			t.Errorf("[%s] expected puts to print to stdout, got=%q (status %d, stderr: %s)", engine, stdout.String(), status, stderr.String())
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	src := "let add = fn(a,b) {\na+b }\nadd(1,2)\n"
+	formatted := "let add = fn(a, b) {\n\ta + b\n};\nadd(1, 2);\n"
+
+	var stdout, stderr bytes.Buffer
+
+	// -d prints a diff and fails when the file isn't formatted
+	filename := writeScript(t, src)
+	if status := run([]string{"fmt", "-d", filename}, strings.NewReader(""), &stdout, &stderr); status != exitError {
+		t.Errorf("expected -d to exit with %d, got=%d", exitError, status)
+	}
+
+	expectedDiff := "@@ -1,3 +1,4 @@\n-let add = fn(a,b) {\n-a+b }\n-add(1,2)\n+let add = fn(a, b) {\n+\ta + b\n+};\n+add(1, 2);\n"
+	if !strings.HasSuffix(stdout.String(), expectedDiff) {
+		t.Errorf("wrong diff, got=%q", stdout.String())
+	}
+
+	// -w rewrites the file, after which -d has nothing to say
+	stdout.Reset()
+	if status := run([]string{"fmt", "-w", filename}, strings.NewReader(""), &stdout, &stderr); status != exitOK {
+		t.Fatalf("expected -w to exit with %d, got=%d (stderr: %s)", exitOK, status, stderr.String())
+	}
+
+	written, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != formatted {
+		t.Errorf("wrong file contents after -w, got=%q", written)
+	}
+
+	if status := run([]string{"fmt", "-d", filename}, strings.NewReader(""), &stdout, &stderr); status != exitOK || stdout.Len() != 0 {
+		t.Errorf("expected no diff for a formatted file, got status=%d, diff=%q", status, stdout.String())
+	}
+
+	// without files stdin is formatted
+	if status := run([]string{"fmt"}, strings.NewReader(src), &stdout, &stderr); status != exitOK {
+		t.Errorf("expected stdin to format, got status=%d", status)
+	}
+
+	if stdout.String() != formatted {
+		t.Errorf("wrong output for stdin, got=%q", stdout.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\nTWO\n3\n4\n5\n6\n7\n8\n9\n10\n11\nTWELVE\n"
+
+	expected := `--- f
++++ f (formatted)
+@@ -1,5 +1,5 @@
+ 1
+-2
++TWO
+ 3
+ 4
+ 5
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++TWELVE
+`
+	if got := string(diff("f", []byte(a), []byte(b))); got != expected {
+		t.Errorf("wrong diff.\nexpected=%q\ngot=%q", expected, got)
+	}
+
+	if got := diff("f", []byte(a), []byte(a)); len(got) != 0 {
+		t.Errorf("expected no diff for equal input, got=%q", got)
+	}
+
+	if got := string(diff("f", []byte("x"), []byte("x\n"))); !strings.Contains(got, "-x\n\\ No newline at end of file\n+x\n") {
+		t.Errorf("expected missing newline to be marked, got=%q", got)
+	}
+}
@@ -0,0 +1,250 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+/*
+The checked operations return the result along with whether it fits in an
+int64. Go wraps around silently on overflow, so the result is still the
+wrapped value when ok is false.
+*/
+
+func AddInt64(a, b int64) (int64, bool) {
+	sum := a + b
+
+	// overflow only happens when both operands have the same sign and the
+	// sum's sign differs from it
+	return sum, (a^sum)&(b^sum) >= 0
+}
+
+func SubInt64(a, b int64) (int64, bool) {
+	diff := a - b
+
+	return diff, (a^b)&(a^diff) >= 0
+}
+
+func MulInt64(a, b int64) (int64, bool) {
+	product := a * b
+
+	if a == 0 || b == 0 {
+		return product, true
+	}
+
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return product, false
+	}
+
+	return product, product/b == a
+}
+
+// ShlInt64 shifts a left by n bits, n must not be negative
+func ShlInt64(a, n int64) (int64, bool) {
+	if a == 0 {
+		return 0, true
+	}
+
+	if n >= 63 {
+		return 0, false
+	}
+
+	shifted := a << n
+
+	return shifted, shifted>>n == a
+}
+
+// DivInt64 can only overflow on math.MinInt64 / -1, b must not be zero
+func DivInt64(a, b int64) (int64, bool) {
+	return a / b, !(a == math.MinInt64 && b == -1)
+}
+
+// MaxShift is the largest count an integer can be shifted left by, it keeps
+// a single shift from building an integer too big to hold in memory
+const MaxShift = 1 << 24
+
+// NewInteger returns v as an Integer if it fits in an int64 and as a BigInt
+// otherwise
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+
+	return &BigInt{Value: v}
+}
+
+// BigValue returns the value of an Integer or a BigInt as a big.Int, it
+// reports false for anything else
+func BigValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+/*
+BigIntInfix applies an arithmetic, bitwise or comparison operator to two
+integers, either of which may be a BigInt. Results that fit in an int64
+come back as an Integer. With checked set a result that doesn't is an
+error, the same as it is for int64s.
+*/
+func BigIntInfix(operator string, left, right Object, checked bool) Object {
+	leftValue, _ := BigValue(left)
+	rightValue, _ := BigValue(right)
+
+	value := new(big.Int)
+
+	switch operator {
+	case "+":
+		value.Add(leftValue, rightValue)
+	case "-":
+		value.Sub(leftValue, rightValue)
+	case "*":
+		value.Mul(leftValue, rightValue)
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newErrorf(ARITHMETIC_ERROR, "division by zero")
+		}
+		// truncates like int64 division, unlike Div
+		value.Quo(leftValue, rightValue)
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newErrorf(ARITHMETIC_ERROR, "division by zero")
+		}
+		value.Rem(leftValue, rightValue)
+
+	case "&":
+		value.And(leftValue, rightValue)
+	case "|":
+		value.Or(leftValue, rightValue)
+	case "^":
+		value.Xor(leftValue, rightValue)
+	case "<<":
+		if rightValue.Sign() < 0 {
+			return newErrorf(ARITHMETIC_ERROR, "negative shift count: %s", right.Inspect())
+		}
+		if rightValue.Cmp(big.NewInt(MaxShift)) > 0 {
+			return newErrorf(ARITHMETIC_ERROR, "shift count too large: %s", right.Inspect())
+		}
+		value.Lsh(leftValue, uint(rightValue.Int64()))
+	case ">>":
+		if rightValue.Sign() < 0 {
+			return newErrorf(ARITHMETIC_ERROR, "negative shift count: %s", right.Inspect())
+		}
+		// shifting out every bit only leaves the sign behind
+		n := uint(leftValue.BitLen())
+		if rightValue.Cmp(big.NewInt(int64(n))) < 0 {
+			n = uint(rightValue.Int64())
+		}
+		value.Rsh(leftValue, n)
+
+	case "<":
+		return nativeBool(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return nativeBool(leftValue.Cmp(rightValue) > 0)
+	case "<=":
+		return nativeBool(leftValue.Cmp(rightValue) <= 0)
+	case ">=":
+		return nativeBool(leftValue.Cmp(rightValue) >= 0)
+	case "==":
+		return nativeBool(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return nativeBool(leftValue.Cmp(rightValue) != 0)
+
+	default:
+		return newErrorf(TYPE_ERROR, "unknown operator: %s", operator)
+	}
+
+	if checked && !value.IsInt64() {
+		return newErrorf(ARITHMETIC_ERROR, "integer overflow: %s %s %s", left.Inspect(), operator, right.Inspect())
+	}
+
+	return NewInteger(value)
+}
+
+// Negate is unary minus, an int64 that can't be negated turns in to a
+// BigInt unless arithmetic is checked
+func Negate(operand Object, checked bool) Object {
+	switch operand := operand.(type) {
+	case *Integer:
+		value, ok := SubInt64(0, operand.Value)
+		if !ok {
+			if checked {
+				return newErrorf(ARITHMETIC_ERROR, "integer overflow: -(%d)", operand.Value)
+			}
+
+			return NewInteger(new(big.Int).Neg(big.NewInt(operand.Value)))
+		}
+
+		return &Integer{Value: value}
+
+	case *BigInt:
+		value := new(big.Int).Neg(operand.Value)
+		if checked && !value.IsInt64() {
+			return newErrorf(ARITHMETIC_ERROR, "integer overflow: -(%s)", operand.Inspect())
+		}
+
+		return NewInteger(value)
+
+	case *Float:
+		return &Float{Value: -operand.Value}
+
+	default:
+		return newErrorf(TYPE_ERROR, "operator '-' not defined on %s", operand.Type())
+	}
+}
+
+// BitNot is ~, which flips every bit of an integer
+func BitNot(operand Object) Object {
+	switch operand := operand.(type) {
+	case *Integer:
+		return &Integer{Value: ^operand.Value}
+
+	case *BigInt:
+		return NewInteger(new(big.Int).Not(operand.Value))
+
+	default:
+		return newErrorf(TYPE_ERROR, "operator '~' not defined on %s", operand.Type())
+	}
+}
+
+/*
+Promote widens the operands of an arithmetic or comparison to floats when
+one of them is a float and the other an integer or float. It reports false
+for anything else, which is left to the other cases.
+*/
+func Promote(left, right Object) (float64, float64, bool) {
+	if left.Type() != FLOAT_OBJ && right.Type() != FLOAT_OBJ {
+		return 0, 0, false
+	}
+
+	l, ok := floatValue(left)
+	if !ok {
+		return 0, 0, false
+	}
+
+	r, ok := floatValue(right)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return l, r, true
+}
+
+func floatValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
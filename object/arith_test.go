@@ -0,0 +1,75 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(a, b int64) (int64, bool)
+		a, b     int64
+		expected int64
+		ok       bool
+	}{
+		{"add", AddInt64, 1, 2, 3, true},
+		{"add", AddInt64, math.MaxInt64, 1, math.MinInt64, false},
+		{"add", AddInt64, math.MinInt64, -1, math.MaxInt64, false},
+		{"add", AddInt64, math.MaxInt64, math.MinInt64, -1, true},
+		{"sub", SubInt64, 1, 2, -1, true},
+		{"sub", SubInt64, math.MinInt64, 1, math.MaxInt64, false},
+		{"sub", SubInt64, 0, math.MinInt64, math.MinInt64, false},
+		{"sub", SubInt64, -1, math.MinInt64, math.MaxInt64, true},
+		{"mul", MulInt64, 6, 7, 42, true},
+		{"mul", MulInt64, 0, math.MinInt64, 0, true},
+		{"mul", MulInt64, math.MaxInt64, 2, -2, false},
+		{"mul", MulInt64, -1, math.MinInt64, math.MinInt64, false},
+		{"mul", MulInt64, math.MinInt64, -1, math.MinInt64, false},
+		{"mul", MulInt64, -1, math.MaxInt64, -math.MaxInt64, true},
+		{"shl", ShlInt64, 1, 62, 1 << 62, true},
+		{"shl", ShlInt64, 1, 63, 0, false},
+		{"shl", ShlInt64, -1, 63, 0, false},
+		{"shl", ShlInt64, 3, 62, -1 << 62, false},
+		{"shl", ShlInt64, 0, 1000, 0, true},
+		{"shl", ShlInt64, -3, 2, -12, true},
+		{"div", DivInt64, 7, 2, 3, true},
+		{"div", DivInt64, math.MinInt64, -1, math.MinInt64, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.fn(tt.a, tt.b)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("%s(%d, %d): expected (%d, %t), got=(%d, %t)", tt.name, tt.a, tt.b, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestBigIntInfix(t *testing.T) {
+	max := &Integer{Value: math.MaxInt64}
+	one := &Integer{Value: 1}
+	over := NewInteger(new(big.Int).Add(big.NewInt(math.MaxInt64), big.NewInt(1)))
+
+	tests := []struct {
+		operator    string
+		left, right Object
+		checked     bool
+		expected    string
+	}{
+		{"+", max, one, false, "9223372036854775808"},
+		{"+", max, one, true, "integer overflow: 9223372036854775807 + 1"},
+		{"-", over, one, false, "9223372036854775807"},
+		{"<", max, over, false, "true"},
+		{"/", over, &Integer{}, false, "division by zero"},
+		{"<<", one, &Integer{Value: -1}, false, "negative shift count: -1"},
+		{">>", over, &Integer{Value: 1000}, false, "0"},
+	}
+
+	for _, tt := range tests {
+		got := BigIntInfix(tt.operator, tt.left, tt.right, tt.checked)
+		if got.Inspect() != tt.expected {
+			t.Errorf("%s %s %s: expected %s, got=%s", tt.left.Inspect(), tt.operator, tt.right.Inspect(), tt.expected, got.Inspect())
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Builtins are the builtins every script starts with, shared by the
+// evaluator and the vm. The vm refers to them by their index so new
+// builtins must only ever be appended.
+var Builtins = NewBuiltinRegistry()
+
+func init() {
+	Builtins.Register("len", &Signature{Params: []Types{{STRING_OBJ, ARRAY_OBJ, HASH_OBJ}}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *String:
+			return &Integer{Value: int64(len(a.Value))}
+
+		case *Array:
+			return &Integer{Value: int64(len(a.Elements))}
+
+		default:
+			return &Integer{Value: int64(a.(*Hash).Len())}
+		}
+	})
+
+	Builtins.Register("first", &Signature{Params: []Types{{STRING_OBJ, ARRAY_OBJ}}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *String:
+			if len(a.Value) == 0 {
+				return NULL
+			}
+
+			return &String{Value: a.Value[:1]}
+
+		default:
+			elements := a.(*Array).Elements
+			if len(elements) == 0 {
+				return NULL
+			}
+
+			return elements[0]
+		}
+	})
+
+	Builtins.Register("last", &Signature{Params: []Types{{STRING_OBJ, ARRAY_OBJ}}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *String:
+			if len(a.Value) == 0 {
+				return NULL
+			}
+
+			return &String{Value: a.Value[len(a.Value)-1:]}
+
+		default:
+			elements := a.(*Array).Elements
+			if len(elements) == 0 {
+				return NULL
+			}
+
+			return elements[len(elements)-1]
+		}
+	})
+
+	// rest returns a new value with everything but the first element, the
+	// argument itself is never modified
+	Builtins.Register("rest", &Signature{Params: []Types{{STRING_OBJ, ARRAY_OBJ}}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *String:
+			if len(a.Value) == 0 {
+				return NULL
+			}
+
+			return &String{Value: a.Value[1:]}
+
+		default:
+			elements := a.(*Array).Elements
+			if len(elements) == 0 {
+				return NULL
+			}
+
+			rest := make([]Object, len(elements)-1)
+			copy(rest, elements[1:])
+
+			return &Array{Elements: rest}
+		}
+	})
+
+	// push returns a new value with the element appended, pushing on to a
+	// string requires the element to be a string as well
+	Builtins.Register("push", &Signature{Params: []Types{{STRING_OBJ, ARRAY_OBJ}, nil}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *String:
+			s, ok := args[1].(*String)
+			if !ok {
+				return invalidArgType("push", 1, Types{STRING_OBJ}, args[1])
+			}
+
+			return &String{Value: a.Value + s.Value}
+
+		default:
+			elements := a.(*Array).Elements
+
+			pushed := make([]Object, len(elements), len(elements)+1)
+			copy(pushed, elements)
+
+			return &Array{Elements: append(pushed, args[1])}
+		}
+	})
+
+	Builtins.Register("keys", &Signature{Params: []Types{{HASH_OBJ}}}, func(args ...Object) Object {
+		elements := []Object{}
+		for _, pair := range args[0].(*Hash).Pairs() {
+			elements = append(elements, pair.Key)
+		}
+
+		return &Array{Elements: elements}
+	})
+
+	Builtins.Register("values", &Signature{Params: []Types{{HASH_OBJ}}}, func(args ...Object) Object {
+		elements := []Object{}
+		for _, pair := range args[0].(*Hash).Pairs() {
+			elements = append(elements, pair.Value)
+		}
+
+		return &Array{Elements: elements}
+	})
+
+	Builtins.Register("has", &Signature{Params: []Types{{HASH_OBJ}, nil}}, func(args ...Object) Object {
+		key, ok := args[1].(Hashable)
+		if !ok {
+			return newErrorf(TYPE_ERROR, "unusable as hash key: %s", args[1].Type())
+		}
+
+		_, ok = args[0].(*Hash).Get(key)
+		return nativeBool(ok)
+	})
+
+	// delete returns a new hash without the key, like push it never
+	// modifies its argument
+	Builtins.Register("delete", &Signature{Params: []Types{{HASH_OBJ}, nil}}, func(args ...Object) Object {
+		key, ok := args[1].(Hashable)
+		if !ok {
+			return newErrorf(TYPE_ERROR, "unusable as hash key: %s", args[1].Type())
+		}
+
+		result := args[0].(*Hash).Copy()
+		result.Delete(key)
+
+		return result
+	})
+
+	Builtins.SetOutput(os.Stdout)
+
+	Builtins.Register("int", &Signature{Params: []Types{{INTEGER_OBJ, FLOAT_OBJ, STRING_OBJ}}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *Float:
+			// truncates towards zero, like a conversion in go
+			if math.IsNaN(a.Value) || math.IsInf(a.Value, 0) {
+				return newErrorf(ARGUMENT_ERROR, "cannot convert %s to INTEGER", a.Inspect())
+			}
+
+			val, _ := big.NewFloat(a.Value).Int(nil)
+			return NewInteger(val)
+
+		case *String:
+			val, ok := new(big.Int).SetString(strings.TrimSpace(a.Value), 10)
+			if !ok {
+				return newErrorf(ARGUMENT_ERROR, "cannot convert %q to INTEGER", a.Value)
+			}
+
+			return NewInteger(val)
+
+		default:
+			return a
+		}
+	})
+
+	Builtins.Register("float", &Signature{Params: []Types{{INTEGER_OBJ, FLOAT_OBJ, STRING_OBJ}}}, func(args ...Object) Object {
+		switch a := args[0].(type) {
+		case *Integer:
+			return &Float{Value: float64(a.Value)}
+
+		case *BigInt:
+			val, _ := new(big.Float).SetInt(a.Value).Float64()
+			return &Float{Value: val}
+
+		case *String:
+			val, err := strconv.ParseFloat(strings.TrimSpace(a.Value), 64)
+			if err != nil {
+				return newErrorf(ARGUMENT_ERROR, "cannot convert %q to FLOAT", a.Value)
+			}
+
+			return &Float{Value: val}
+
+		default:
+			return a
+		}
+	})
+}
+
+// SetOutput sends what puts prints to w, registering puts if r doesn't have
+// it yet. The default builtins print to standard output.
+func (r *BuiltinRegistry) SetOutput(w io.Writer) {
+	r.Register("puts", &Signature{Params: []Types{nil}, Variadic: true}, func(args ...Object) Object {
+		for _, arg := range args {
+			fmt.Fprintln(w, arg.Inspect())
+		}
+
+		return NULL
+	})
+}
+
+func nativeBool(v bool) *Boolean {
+	if v {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+func newErrorf(kind ErrorKind, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
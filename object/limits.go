@@ -0,0 +1,123 @@
+package object
+
+import (
+	"context"
+)
+
+// DefaultMaxDepth is how deeply function calls nest when no other limit is
+// set, the same depth the vm's frames allow
+const DefaultMaxDepth = 1024
+
+/*
+Limits bound what evaluating a script may use, so scripts from untrusted
+sources can't hang or crash the host. Fields left zero don't limit
+anything, apart from MaxDepth which falls back to DefaultMaxDepth as
+unbounded recursion overflows the go stack.
+
+Running over MaxDepth is a RuntimeError like it is in the vm, scripts can
+catch it. Running over any other limit is a LimitError, which try
+statements don't catch.
+*/
+type Limits struct {
+	Context  context.Context // evaluation stops once it is done
+	MaxDepth int             // function calls in progress at once
+	MaxSteps int             // nodes evaluated
+	MaxAlloc int             // approximate bytes allocated for values, memory freed along the way isn't given back
+}
+
+// Usage counts what evaluation has used up against its limits. Every scope
+// of a program shares one.
+type Usage struct {
+	limits Limits
+	done   <-chan struct{}
+
+	depth int
+	steps int
+	alloc int
+}
+
+func (u *Usage) reset(l Limits) {
+	u.limits = l
+	u.depth, u.steps, u.alloc = 0, 0, 0
+
+	u.done = nil
+	if l.Context != nil {
+		u.done = l.Context.Done()
+	}
+}
+
+// Step counts a node being evaluated
+func (u *Usage) Step() *Error {
+	u.steps++
+	if u.limits.MaxSteps > 0 && u.steps > u.limits.MaxSteps {
+		return newErrorf(LIMIT_ERROR, "evaluation exceeded %d steps", u.limits.MaxSteps)
+	}
+
+	return nil
+}
+
+// Call counts a function call starting, every call that succeeds must be
+// followed by a Return, even when the call panics
+func (u *Usage) Call() *Error {
+	max := u.limits.MaxDepth
+	if max <= 0 {
+		max = DefaultMaxDepth
+	}
+
+	if u.depth >= max {
+		return newErrorf(RUNTIME_ERROR, "stack overflow")
+	}
+
+	u.depth++
+
+	return nil
+}
+
+func (u *Usage) Return() {
+	u.depth--
+}
+
+// Allocate counts the memory taken up by a value that was just created
+func (u *Usage) Allocate(obj Object) *Error {
+	u.alloc += sizeOf(obj)
+	if u.limits.MaxAlloc > 0 && u.alloc > u.limits.MaxAlloc {
+		return newErrorf(LIMIT_ERROR, "evaluation exceeded %d bytes of allocations", u.limits.MaxAlloc)
+	}
+
+	return nil
+}
+
+// Interrupted reports the context being done as an error
+func (u *Usage) Interrupted() *Error {
+	select {
+	case <-u.done:
+		return newErrorf(LIMIT_ERROR, "evaluation stopped: %s", u.limits.Context.Err())
+	default:
+		return nil
+	}
+}
+
+// sizeOf estimates the bytes go allocates for a value, not counting the
+// values it holds as they are counted when they are created
+func sizeOf(obj Object) int {
+	switch obj := obj.(type) {
+	case *Boolean, *Null:
+		// shared, never allocated
+		return 0
+
+	case *String:
+		return 16 + len(obj.Value)
+
+	case *BigInt:
+		return 32 + 8*len(obj.Value.Bits())
+
+	case *Array:
+		return 24 + 8*len(obj.Elements)
+
+	case *Hash:
+		return 48 + 64*obj.Len()
+
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,70 @@
+package object
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUsageDepth(t *testing.T) {
+	u := &Usage{}
+
+	for i := 0; i < DefaultMaxDepth; i++ {
+		if err := u.Call(); err != nil {
+			t.Fatalf("call %d: unexpected error %q", i, err.Message)
+		}
+	}
+
+	if err := u.Call(); err == nil || err.Kind != RUNTIME_ERROR || err.Message != "stack overflow" {
+		t.Fatalf("expected a stack overflow, got=%v", err)
+	}
+
+	u.Return()
+	if err := u.Call(); err != nil {
+		t.Errorf("expected room for a call after a return, got=%q", err.Message)
+	}
+
+	u.reset(Limits{MaxDepth: 1})
+	if err := u.Call(); err != nil {
+		t.Errorf("expected no calls in progress after a reset, got=%q", err.Message)
+	}
+}
+
+func TestUsageAllocate(t *testing.T) {
+	u := &Usage{}
+	u.reset(Limits{MaxAlloc: 100})
+
+	// shared values take up nothing
+	for i := 0; i < 10; i++ {
+		if err := u.Allocate(TRUE); err != nil {
+			t.Fatalf("unexpected error %q", err.Message)
+		}
+	}
+
+	if err := u.Allocate(&String{Value: "0123456789"}); err != nil {
+		t.Fatalf("unexpected error %q", err.Message)
+	}
+
+	err := u.Allocate(&Array{Elements: make([]Object, 10)})
+	if err == nil || err.Kind != LIMIT_ERROR || err.Message != "evaluation exceeded 100 bytes of allocations" {
+		t.Errorf("expected to run out of allocations, got=%v", err)
+	}
+}
+
+func TestUsageInterrupted(t *testing.T) {
+	u := &Usage{}
+	if err := u.Interrupted(); err != nil {
+		t.Fatalf("unexpected error without a context %q", err.Message)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u.reset(Limits{Context: ctx})
+
+	if err := u.Interrupted(); err != nil {
+		t.Fatalf("unexpected error before cancelling %q", err.Message)
+	}
+
+	cancel()
+	if err := u.Interrupted(); err == nil || err.Message != "evaluation stopped: context canceled" {
+		t.Errorf("expected the cancellation, got=%v", err)
+	}
+}
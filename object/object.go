@@ -3,13 +3,19 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/cijin/go-interpreter/ast"
+	"github.com/cijin/go-interpreter/code"
+	"github.com/cijin/go-interpreter/token"
 )
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -17,10 +23,25 @@ const (
 	NULL_OBJ         = "NULL"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	ITERATOR_OBJ     = "ITERATOR"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type ObjectType string
 
+// there is only ever one true, false & null, so they can be compared by
+// identity
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -34,6 +55,35 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+/*
+big int, an integer that doesn't fit in an int64. It has the same type as
+an Integer so the two are interchangeable in scripts, and NewInteger only
+makes one when it has to, so a value always has a single representation.
+*/
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+// float
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always shows a float as one, 2.0 rather than 2
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+
+	return s + ".0"
+}
+
 // string
 type String struct {
 	Value string
@@ -48,7 +98,7 @@ type Boolean struct {
 }
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
-func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b) }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
 // return
 type ReturnValue struct {
@@ -58,12 +108,167 @@ type ReturnValue struct {
 func (r *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
 
+// break & continue unwind the statements of a loop body, the same way a
+// return value unwinds a function body
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// the kind of an error groups errors by what went wrong, without having to
+// match on the message
+type ErrorKind string
+
+const (
+	RUNTIME_ERROR    ErrorKind = "RuntimeError"
+	TYPE_ERROR       ErrorKind = "TypeError"
+	NAME_ERROR       ErrorKind = "NameError"
+	INDEX_ERROR      ErrorKind = "IndexError"
+	ARITHMETIC_ERROR ErrorKind = "ArithmeticError"
+	ARGUMENT_ERROR   ErrorKind = "ArgumentError"
+	LIMIT_ERROR      ErrorKind = "LimitError"
+
+	// the kind of values thrown by scripts that don't name one
+	THROWN_ERROR ErrorKind = "Error"
+)
+
+// a function call an error unwound through, Pos is where it was called
+type Frame struct {
+	Function string // empty for functions that were never given a name
+	Pos      token.Position
+}
+
+func (f Frame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "anonymous function"
+	}
+
+	// functions called by a go program embedding the interpreter
+	if !f.Pos.IsValid() {
+		return fmt.Sprintf("in %s, called by the host", name)
+	}
+
+	return fmt.Sprintf("in %s, called at %s", name, f.Pos)
+}
+
+// error, Pos is the position of the node that failed to evaluate and
+// Frames the calls it unwound through, innermost first. Value is the value
+// of a throw statement, it is nil for errors raised by the engines
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Pos     token.Position
+	Frames  []Frame
+	Value   Object
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return e.Message }
+func (e *Error) Inspect() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+
+	return e.Pos.String() + ": " + e.Message
+}
+
+// so the vm & compiler can hand errors back as regular go errors
+func (e *Error) Error() string { return e.Inspect() }
+
+/*
+ * Thrown turns the value of a throw statement in to an error. Hashes give
+ * the error its "message" & "kind", so rethrowing a caught error keeps
+ * them, other values are used as the message. Errors are rethrown as is.
+ */
+func Thrown(val Object) *Error {
+	if err, ok := val.(*Error); ok {
+		return err
+	}
+
+	err := &Error{Kind: THROWN_ERROR, Message: val.Inspect(), Value: val}
+
+	switch val := val.(type) {
+	case *String:
+		err.Message = val.Value
+
+	case *Hash:
+		if msg, ok := val.Get(&String{Value: "message"}); ok {
+			if msg, ok := msg.(*String); ok {
+				err.Message = msg.Value
+			}
+		}
+
+		if kind, ok := val.Get(&String{Value: "kind"}); ok {
+			if kind, ok := kind.(*String); ok {
+				err.Kind = ErrorKind(kind.Value)
+			}
+		}
+	}
+
+	return err
+}
+
+// Caught is what a catch block sees of an error, the value that was thrown
+// or a hash with the "message" & "kind" of errors raised by the engines
+func (e *Error) Caught() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+
+	hash := NewHash()
+	hash.Set(&String{Value: "message"}, &String{Value: e.Message})
+	hash.Set(&String{Value: "kind"}, &String{Value: string(e.Kind)})
+
+	return hash
+}
+
+/*
+ * Traceback is the error followed by the calls that led to it, one per
+ * line:
+ *
+ *	script.mk:2:12: ArithmeticError: division by zero
+ *		in divide, called at script.mk:5:10
+ *		in main, called at script.mk:8:1
+ *
+ * A frame repeated by recursion is only written out once.
+ */
+func (e *Error) Traceback() string {
+	var buf strings.Builder
+
+	if e.Pos.IsValid() {
+		buf.WriteString(e.Pos.String() + ": ")
+	}
+
+	if e.Kind != "" {
+		buf.WriteString(string(e.Kind) + ": ")
+	}
+
+	buf.WriteString(e.Message)
+
+	for i := 0; i < len(e.Frames); {
+		frame := e.Frames[i]
+
+		repeated := 0
+		for i++; i < len(e.Frames) && e.Frames[i] == frame; i++ {
+			repeated++
+		}
+
+		buf.WriteString("\n\t" + frame.String())
+		switch {
+		case repeated == 1:
+			buf.WriteString("\n\t... repeated 1 more time")
+		case repeated > 1:
+			fmt.Fprintf(&buf, "\n\t... repeated %d more times", repeated)
+		}
+	}
+
+	return buf.String()
+}
 
 // null
 type Null struct{}
@@ -80,37 +285,408 @@ type Builtin struct {
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// array
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string  { return inspect(a, nil) }
+
+// Objects that can be used as hash keys, keys hash by value so two
+// different *String objects with the same value map to the same entry
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Big   string // the digits of an integer too big for Value, compared exactly
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// HashKey agrees with Integer.HashKey for values that fit in an int64,
+// bigger values are keyed by their digits so no two of them share a key
+func (b *BigInt) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return HashKey{Type: b.Type(), Value: uint64(b.Value.Int64())}
+	}
+
+	return HashKey{Type: b.Type(), Big: b.Value.String()}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// hash, pairs are kept in insertion order
+type Hash struct {
+	pairs map[HashKey]HashPair
+	keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return inspect(h, nil) }
+
+func (h *Hash) Len() int { return len(h.keys) }
+
+/*
+inspect prints arrays & hashes with the collections they hold, seen are the
+ones being printed further out. Assigning to an index can put a collection
+inside itself, it is printed as [...] or {...} where it repeats:
+
+	let a = [0]; a[0] = a; a    // [[...]]
+*/
+func inspect(obj Object, seen map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if seen[obj] {
+			return "[...]"
+		}
+
+		seen = enter(seen, obj)
+		defer delete(seen, obj)
+
+		var buf bytes.Buffer
+		var elements []string
+
+		for _, el := range obj.Elements {
+			elements = append(elements, inspect(el, seen))
+		}
+
+		buf.WriteString("[")
+		buf.WriteString(strings.Join(elements, ", "))
+		buf.WriteString("]")
+
+		return buf.String()
+
+	case *Hash:
+		if seen[obj] {
+			return "{...}"
+		}
+
+		seen = enter(seen, obj)
+		defer delete(seen, obj)
+
+		var buf bytes.Buffer
+		var pairs []string
+
+		for _, pair := range obj.Pairs() {
+			pairs = append(pairs, pair.Key.Inspect()+": "+inspect(pair.Value, seen))
+		}
+
+		buf.WriteString("{")
+		buf.WriteString(strings.Join(pairs, ", "))
+		buf.WriteString("}")
+
+		return buf.String()
+
+	default:
+		return obj.Inspect()
+	}
+}
+
+func enter(seen map[Object]bool, obj Object) map[Object]bool {
+	if seen == nil {
+		seen = make(map[Object]bool)
+	}
+
+	seen[obj] = true
+
+	return seen
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+
+	return pair.Value, true
+}
+
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.pairs[hashKey]; !ok {
+		h.keys = append(h.keys, hashKey)
+	}
+
+	h.pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+func (h *Hash) Delete(key Hashable) bool {
+	hashKey := key.HashKey()
+	if _, ok := h.pairs[hashKey]; !ok {
+		return false
+	}
+
+	delete(h.pairs, hashKey)
+	for i, k := range h.keys {
+		if k == hashKey {
+			h.keys = append(h.keys[:i:i], h.keys[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+// Pairs returns the key/value pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.keys))
+	for _, k := range h.keys {
+		pairs = append(pairs, h.pairs[k])
+	}
+
+	return pairs
+}
+
+// Copy returns a shallow copy, the keys & values themselves are shared
+func (h *Hash) Copy() *Hash {
+	c := NewHash()
+	for _, k := range h.keys {
+		c.pairs[k] = h.pairs[k]
+	}
+	c.keys = append(c.keys, h.keys...)
+
+	return c
+}
+
+/*
+iterator, walks the elements of an array, the characters of a string or
+the keys of a hash in insertion order. What it walks is fixed when it is
+made, so a loop isn't thrown off by changes made to the value inside it.
+*/
+type Iterator struct {
+	items []Object
+	next  int
+}
+
+// NewIterator reports false for values that can't be iterated over
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		items := make([]Object, len(obj.Elements))
+		copy(items, obj.Elements)
+
+		return &Iterator{items: items}, true
+
+	case *String:
+		// one byte at a time, the same as indexing a string
+		items := make([]Object, len(obj.Value))
+		for i := 0; i < len(obj.Value); i++ {
+			items[i] = &String{Value: obj.Value[i : i+1]}
+		}
+
+		return &Iterator{items: items}, true
+
+	case *Hash:
+		items := make([]Object, 0, obj.Len())
+		for _, pair := range obj.Pairs() {
+			items = append(items, pair.Key)
+		}
+
+		return &Iterator{items: items}, true
+
+	default:
+		return nil, false
+	}
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Next reports false once every item has been handed out
+func (it *Iterator) Next() (Object, bool) {
+	if it.next >= len(it.items) {
+		return nil, false
+	}
+
+	item := it.items[it.next]
+	it.next++
+
+	return item, true
+}
+
 // Enviornment
 type Enviornment struct {
-	store map[string]Object
+	store map[string]binding
 	outer *Enviornment
+
+	checked  bool // integer overflow is an error rather than growing a big integer
+	builtins *BuiltinRegistry
+	usage    *Usage
+}
+
+// binding is a value bound to a name, along with whether it can change
+type binding struct {
+	value    Object
+	constant bool
+	pos      token.Position // where a constant was declared
 }
 
 func NewEnviornment() *Enviornment {
-	return &Enviornment{store: make(map[string]Object), outer: nil}
+	return &Enviornment{store: make(map[string]binding), outer: nil, usage: &Usage{}}
 }
 
+// NewEnclosedEnviornment starts a scope inside outer, taking on its
+// arithmetic mode, builtins & limits
 func NewEnclosedEnviornment(outer *Enviornment) *Enviornment {
-	return &Enviornment{store: make(map[string]Object), outer: outer}
+	return &Enviornment{
+		store:    make(map[string]binding),
+		outer:    outer,
+		checked:  outer.checked,
+		builtins: outer.builtins,
+		usage:    outer.usage,
+	}
+}
+
+// CheckArithmetic turns integer overflow on + - * / in to an error for code
+// evaluated in this scope and the scopes started from it afterwards
+func (e *Enviornment) CheckArithmetic(on bool) {
+	e.checked = on
+}
+
+func (e *Enviornment) ArithmeticChecked() bool {
+	return e.checked
+}
+
+// SetBuiltins replaces the builtins for code evaluated in this scope and the
+// scopes started from it afterwards
+func (e *Enviornment) SetBuiltins(r *BuiltinRegistry) {
+	e.builtins = r
+}
+
+// Builtins returns the builtins names resolve to when they aren't bound,
+// the default ones unless others were set
+func (e *Enviornment) Builtins() *BuiltinRegistry {
+	if e.builtins == nil {
+		return Builtins
+	}
+
+	return e.builtins
+}
+
+// SetLimits limits evaluation of every scope the enviornment shares its
+// usage with, the program it is part of, and starts counting steps &
+// allocations over
+func (e *Enviornment) SetLimits(l Limits) {
+	e.usage.reset(l)
 }
 
+func (e *Enviornment) Usage() *Usage {
+	return e.usage
+}
+
+// Get looks name up in this scope and then every enclosing scope in turn,
+// so the innermost binding shadows any outer ones
 func (e *Enviornment) Get(name string) (Object, bool) {
-	val, ok := e.store[name]
-	if !ok && e.outer != nil {
-		val, ok = e.outer.store[name]
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.store[name]; ok {
+			return b.value, true
+		}
 	}
 
-	return val, ok
+	return nil, false
 }
 
+// Set always binds name in this scope, shadowing any outer binding
 func (e *Enviornment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.store[name] = binding{value: val}
 
 	return val
 }
 
+// SetConst binds name in this scope like Set, pos is where the constant
+// was declared. Nothing stops Set from replacing it, callers check Const
+// first.
+func (e *Enviornment) SetConst(name string, val Object, pos token.Position) Object {
+	e.store[name] = binding{value: val, constant: true, pos: pos}
+
+	return val
+}
+
+/*
+Const reports whether name is bound to a constant, and where the constant
+was declared. With outer set the binding name resolves to is checked, the
+same one Get & Assign find, otherwise only a binding in this scope counts.
+*/
+func (e *Enviornment) Const(name string, outer bool) (token.Position, bool) {
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.store[name]; ok {
+			return b.pos, b.constant
+		}
+
+		if !outer {
+			break
+		}
+	}
+
+	return token.Position{}, false
+}
+
+// Names returns every name visible from this scope, including the ones
+// bound in enclosing scopes
+func (e *Enviornment) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// Assign updates the binding in the nearest scope that defines name, it
+// reports false without binding anything if no scope does. Constants are
+// updated like any other binding, callers check Const first.
+func (e *Enviornment) Assign(name string, val Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.store[name]; ok {
+			b.value = val
+			env.store[name] = b
+			return val, true
+		}
+	}
+
+	return nil, false
+}
+
 // Function
 type Function struct {
+	Name string // the name it was bound to by let or const, if any
 	Args []*ast.Identifier
 	Body *ast.BlockStatement
 	Env  *Enviornment
@@ -134,3 +710,31 @@ func (f *Function) Inspect() string {
 
 	return buf.String()
 }
+
+// Compiled function, Positions maps the offset of an instruction to the
+// position of the node it was compiled from
+type CompiledFunction struct {
+	Name          string
+	Instructions  code.Instructions
+	Positions     map[int]token.Position
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure, every function is wrapped in one at runtime along with the
+// free variables it captured. To scripts it is just a function, so it
+// shares the type with evaluator functions.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
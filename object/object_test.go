@@ -0,0 +1,415 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cijin/go-interpreter/token"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypes(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("integer 1 and boolean true have the same hash key")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1500, "1500.0"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("expected %q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestBigIntHashKey(t *testing.T) {
+	small := &Integer{Value: 42}
+	big1 := &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+	big2 := &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with the same value have different hash keys")
+	}
+
+	if (&BigInt{Value: big.NewInt(42)}).HashKey() != small.HashKey() {
+		t.Errorf("big and small integers with the same value have different hash keys")
+	}
+
+	if big1.HashKey() == small.HashKey() {
+		t.Errorf("integers with different values have the same hash key")
+	}
+
+	// the fnv hash of the digits of 2^70, which used to be its key
+	h := fnv.New64a()
+	h.Write([]byte(big1.Value.String()))
+	collides := &Integer{Value: int64(h.Sum64())}
+
+	hash := NewHash()
+	hash.Set(big1, &String{Value: "big"})
+	hash.Set(collides, &String{Value: "small"})
+
+	if got, _ := hash.Get(big1); hash.Len() != 2 || got.Inspect() != "big" {
+		t.Errorf("expected a big integer & an integer to be separate keys, got=%s", hash.Inspect())
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	if _, ok := NewInteger(big.NewInt(math.MaxInt64)).(*Integer); !ok {
+		t.Errorf("expected a value that fits in an int64 to be an Integer")
+	}
+
+	over := new(big.Int).Add(big.NewInt(math.MaxInt64), big.NewInt(1))
+	obj := NewInteger(over)
+	if _, ok := obj.(*BigInt); !ok {
+		t.Fatalf("expected a value that doesn't fit in an int64 to be a BigInt, got=%T", obj)
+	}
+
+	if obj.Type() != INTEGER_OBJ || obj.Inspect() != "9223372036854775808" {
+		t.Errorf("expected INTEGER 9223372036854775808, got=%s %s", obj.Type(), obj.Inspect())
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	h := NewHash()
+	h.Set(&String{Value: "b"}, &Integer{Value: 2})
+	h.Set(&String{Value: "a"}, &Integer{Value: 1})
+	h.Set(&String{Value: "c"}, &Integer{Value: 3})
+	h.Set(&String{Value: "b"}, &Integer{Value: 4})
+
+	if h.Inspect() != "{b: 4, a: 1, c: 3}" {
+		t.Errorf("expected {b: 4, a: 1, c: 3}, got=%s", h.Inspect())
+	}
+
+	if !h.Delete(&String{Value: "a"}) {
+		t.Errorf("expected delete to report key as found")
+	}
+
+	if h.Delete(&String{Value: "a"}) {
+		t.Errorf("expected second delete to report key as missing")
+	}
+
+	if h.Inspect() != "{b: 4, c: 3}" {
+		t.Errorf("expected {b: 4, c: 3}, got=%s", h.Inspect())
+	}
+}
+
+func TestCyclicInspect(t *testing.T) {
+	a := &Array{Elements: []Object{&Integer{Value: 1}}}
+	h := NewHash()
+	h.Set(&String{Value: "a"}, a)
+	h.Set(&String{Value: "h"}, h)
+	a.Elements = append(a.Elements, a, h)
+
+	if a.Inspect() != "[1, [...], {a: [...], h: {...}}]" {
+		t.Errorf("expected [1, [...], {a: [...], h: {...}}], got=%s", a.Inspect())
+	}
+
+	if h.Inspect() != "{a: [1, [...], {...}], h: {...}}" {
+		t.Errorf("expected {a: [1, [...], {...}], h: {...}}, got=%s", h.Inspect())
+	}
+}
+
+func TestIterator(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, TRUE)
+	hash.Set(&String{Value: "a"}, FALSE)
+
+	array := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}
+
+	tests := []struct {
+		iterable Object
+		expected []string
+	}{
+		{array, []string{"1", "2"}},
+		{&String{Value: "hi"}, []string{"h", "i"}},
+		{hash, []string{"b", "a"}},
+		{&Array{}, nil},
+	}
+
+	for _, tt := range tests {
+		it, ok := NewIterator(tt.iterable)
+		if !ok {
+			t.Fatalf("expected %s to be iterable", tt.iterable.Type())
+		}
+
+		// changes after the iterator was made aren't seen
+		array.Elements[0] = NULL
+
+		var got []string
+		for item, ok := it.Next(); ok; item, ok = it.Next() {
+			got = append(got, item.Inspect())
+		}
+
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("iterating over %s: expected %v, got=%v", tt.iterable.Inspect(), tt.expected, got)
+		}
+
+		array.Elements[0] = &Integer{Value: 1}
+	}
+
+	if _, ok := NewIterator(&Integer{Value: 1}); ok {
+		t.Errorf("expected an integer not to be iterable")
+	}
+}
+
+func TestErrorTraceback(t *testing.T) {
+	at := func(line, column int) token.Position {
+		return token.Position{Filename: "a.mk", Line: line, Column: column}
+	}
+
+	tests := []struct {
+		err      *Error
+		expected string
+	}{
+		// errors made outside of the engines may have neither
+		{&Error{Message: "oops"}, "oops"},
+		{&Error{Kind: TYPE_ERROR, Message: "oops"}, "TypeError: oops"},
+		{
+			&Error{Kind: NAME_ERROR, Message: "oops", Pos: at(2, 3), Frames: []Frame{{"f", at(4, 1)}}},
+			"a.mk:2:3: NameError: oops\n\tin f, called at a.mk:4:1",
+		},
+		{
+			&Error{Message: "oops", Pos: at(1, 1), Frames: []Frame{{"", at(1, 5)}, {"g", at(2, 1)}, {"g", at(2, 1)}, {"g", at(3, 1)}}},
+			"a.mk:1:1: oops\n\tin anonymous function, called at a.mk:1:5\n\tin g, called at a.mk:2:1\n\t... repeated 1 more time\n\tin g, called at a.mk:3:1",
+		},
+		{
+			&Error{Message: "oops", Pos: at(1, 1), Frames: []Frame{{"f", token.Position{}}}},
+			"a.mk:1:1: oops\n\tin f, called by the host",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Traceback(); got != tt.expected {
+			t.Errorf("Traceback() wrong.\nexpected=%q\ngot=%q", tt.expected, got)
+		}
+
+		// only the traceback shows the kind & frames
+		if tt.err.Pos.IsValid() && tt.err.Inspect() != tt.err.Pos.String()+": oops" {
+			t.Errorf("Inspect() wrong, got=%q", tt.err.Inspect())
+		}
+	}
+}
+
+func TestThrownAndCaught(t *testing.T) {
+	str := func(s string) *String { return &String{Value: s} }
+
+	hash := NewHash()
+	hash.Set(str("kind"), str("ValueError"))
+	hash.Set(str("message"), str("bad"))
+
+	tests := []struct {
+		thrown  Object
+		kind    ErrorKind
+		message string
+	}{
+		{str("boom"), THROWN_ERROR, "boom"},
+		{&Integer{Value: 1}, THROWN_ERROR, "1"},
+		{NULL, THROWN_ERROR, "null"},
+		{hash, "ValueError", "bad"},
+		{NewHash(), THROWN_ERROR, "{}"},
+	}
+
+	for _, tt := range tests {
+		err := Thrown(tt.thrown)
+		if err.Kind != tt.kind || err.Message != tt.message {
+			t.Errorf("Thrown(%s) wrong. expected=%s %q, got=%s %q", tt.thrown.Inspect(), tt.kind, tt.message, err.Kind, err.Message)
+		}
+
+		// catch blocks get back what was thrown
+		if err.Caught() != tt.thrown {
+			t.Errorf("expected Caught() to be %s, got=%s", tt.thrown.Inspect(), err.Caught().Inspect())
+		}
+	}
+
+	err := &Error{Kind: INDEX_ERROR, Message: "index out of range: 2"}
+	if Thrown(err) != err {
+		t.Errorf("expected errors to be rethrown as is")
+	}
+
+	caught, ok := err.Caught().(*Hash)
+	if !ok {
+		t.Fatalf("expected Caught() to be *Hash, got=%T", err.Caught())
+	}
+
+	// rethrowing what was caught keeps the kind & message
+	if again := Thrown(caught); again.Kind != err.Kind || again.Message != err.Message {
+		t.Errorf("expected %s %q, got=%s %q", err.Kind, err.Message, again.Kind, again.Message)
+	}
+}
+
+func TestEnviornmentGet(t *testing.T) {
+	global := NewEnviornment()
+	global.Set("a", &Integer{Value: 1})
+	global.Set("b", &Integer{Value: 2})
+
+	middle := NewEnclosedEnviornment(global)
+	middle.Set("b", &Integer{Value: 20})
+
+	inner := NewEnclosedEnviornment(NewEnclosedEnviornment(middle))
+
+	tests := []struct {
+		name     string
+		expected int64
+	}{
+		{"a", 1},
+		{"b", 20},
+	}
+
+	for _, tt := range tests {
+		val, ok := inner.Get(tt.name)
+		if !ok {
+			t.Errorf("expected %s to be found", tt.name)
+			continue
+		}
+
+		if val.(*Integer).Value != tt.expected {
+			t.Errorf("expected %s to be %d, got=%s", tt.name, tt.expected, val.Inspect())
+		}
+	}
+
+	if _, ok := inner.Get("c"); ok {
+		t.Errorf("expected c to be undefined")
+	}
+}
+
+func TestEnviornmentAssign(t *testing.T) {
+	global := NewEnviornment()
+	global.Set("a", &Integer{Value: 1})
+
+	middle := NewEnclosedEnviornment(global)
+	middle.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnviornment(middle)
+
+	if _, ok := inner.Assign("a", &Integer{Value: 10}); !ok {
+		t.Fatalf("expected a to be assignable")
+	}
+
+	if _, ok := inner.Assign("b", &Integer{Value: 20}); !ok {
+		t.Fatalf("expected b to be assignable")
+	}
+
+	if val, _ := global.Get("a"); val.(*Integer).Value != 10 {
+		t.Errorf("expected global a to be updated to 10, got=%s", val.Inspect())
+	}
+
+	if val, _ := middle.Get("b"); val.(*Integer).Value != 20 {
+		t.Errorf("expected middle b to be updated to 20, got=%s", val.Inspect())
+	}
+
+	if _, ok := inner.store["a"]; ok {
+		t.Errorf("expected assign not to bind a in the inner scope")
+	}
+
+	if _, ok := inner.Assign("c", &Integer{Value: 3}); ok {
+		t.Errorf("expected assigning undefined c to fail")
+	}
+
+	if _, ok := inner.Get("c"); ok {
+		t.Errorf("expected failed assign not to bind c")
+	}
+}
+
+func TestEnviornmentConst(t *testing.T) {
+	pos := token.Position{Line: 3, Column: 1}
+
+	global := NewEnviornment()
+	global.SetConst("a", &Integer{Value: 1}, pos)
+	global.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnviornment(global)
+	inner.Set("b", &Integer{Value: 3})
+
+	if got, ok := inner.Const("a", true); !ok || got != pos {
+		t.Errorf("expected a to be a constant declared at %s, got=%s %t", pos, got, ok)
+	}
+
+	if _, ok := inner.Const("a", false); ok {
+		t.Errorf("expected a not to be a constant in the inner scope")
+	}
+
+	if _, ok := inner.Const("b", true); ok {
+		t.Errorf("expected b not to be a constant")
+	}
+
+	// the inner binding shadows the outer constant
+	inner.Set("a", &Integer{Value: 4})
+	if _, ok := inner.Const("a", true); ok {
+		t.Errorf("expected a to resolve to the inner binding")
+	}
+
+	// assigning keeps a constant a constant
+	global.Assign("a", &Integer{Value: 5})
+	if _, ok := global.Const("a", false); !ok {
+		t.Errorf("expected a to still be a constant after assigning it")
+	}
+}
+
+func TestEnviornmentNames(t *testing.T) {
+	global := NewEnviornment()
+	global.Set("a", &Integer{Value: 1})
+	global.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnviornment(global)
+	inner.Set("b", &Integer{Value: 3})
+	inner.Set("c", &Integer{Value: 4})
+
+	names := inner.Names()
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Errorf("expected a,b,c, got=%v", names)
+	}
+}
+
+func TestEnviornmentCheckArithmetic(t *testing.T) {
+	global := NewEnviornment()
+	global.CheckArithmetic(true)
+
+	inner := NewEnclosedEnviornment(global)
+	if !inner.ArithmeticChecked() {
+		t.Errorf("expected enclosed scope to check arithmetic")
+	}
+
+	if NewEnviornment().ArithmeticChecked() {
+		t.Errorf("expected arithmetic to be unchecked by default")
+	}
+}
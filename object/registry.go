@@ -0,0 +1,186 @@
+package object
+
+import (
+	"strings"
+)
+
+// Types are the types an argument may have, an argument of any type is
+// accepted when there are none
+type Types []ObjectType
+
+func (t Types) accepts(obj Object) bool {
+	if len(t) == 0 {
+		return true
+	}
+
+	for _, typ := range t {
+		if obj.Type() == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// written the way errors list them, "STRING, ARRAY or HASH"
+func (t Types) String() string {
+	names := make([]string, len(t))
+	for i, typ := range t {
+		names[i] = string(typ)
+	}
+
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+/*
+Signature describes the arguments of a builtin, they are checked before the
+builtin is called so every builtin reports bad arguments the same way:
+
+	wrong number of arguments for len: want=1, got=2
+	wrong type of argument 1 for len: want=STRING, ARRAY or HASH, got=INTEGER
+
+With Variadic set the last param, which there must be, can be repeated any
+number of times including none.
+*/
+type Signature struct {
+	Params   []Types
+	Variadic bool
+}
+
+func (s *Signature) Check(name string, args []Object) *Error {
+	switch {
+	case s.Variadic && len(args) < len(s.Params)-1:
+		return newErrorf(ARGUMENT_ERROR, "wrong number of arguments for %s: want at least %d, got=%d", name, len(s.Params)-1, len(args))
+
+	case !s.Variadic && len(args) != len(s.Params):
+		return newErrorf(ARGUMENT_ERROR, "wrong number of arguments for %s: want=%d, got=%d", name, len(s.Params), len(args))
+	}
+
+	for i, arg := range args {
+		types := s.Params[min(i, len(s.Params)-1)]
+		if !types.accepts(arg) {
+			return invalidArgType(name, i, types, arg)
+		}
+	}
+
+	return nil
+}
+
+type BuiltinDef struct {
+	Name      string
+	Signature *Signature // nil for builtins that check their own arguments
+	Builtin   *Builtin
+}
+
+/*
+BuiltinRegistry holds the builtins names resolve to when nothing in scope
+is bound to them. Attach one to an enviornment with SetBuiltins to give a
+script its own set of builtins.
+
+Builtins named "ns.name" are in the namespace ns, scripts get at them
+through a hash of the namespace's builtins: ns["name"](...).
+*/
+type BuiltinRegistry struct {
+	defs  []*BuiltinDef // in the order they were registered
+	index map[string]int
+}
+
+func NewBuiltinRegistry() *BuiltinRegistry {
+	return &BuiltinRegistry{index: make(map[string]int)}
+}
+
+// Register adds a builtin, or replaces the one registered as name keeping
+// its place. fn is only called with arguments that match sig.
+func (r *BuiltinRegistry) Register(name string, sig *Signature, fn BuiltinFunction) {
+	builtin := &Builtin{Fn: fn}
+	if sig != nil {
+		builtin.Fn = func(args ...Object) Object {
+			if err := sig.Check(name, args); err != nil {
+				return err
+			}
+
+			return fn(args...)
+		}
+	}
+
+	def := &BuiltinDef{Name: name, Signature: sig, Builtin: builtin}
+
+	if i, ok := r.index[name]; ok {
+		r.defs[i] = def
+		return
+	}
+
+	r.index[name] = len(r.defs)
+	r.defs = append(r.defs, def)
+}
+
+func (r *BuiltinRegistry) Def(name string) (*BuiltinDef, bool) {
+	i, ok := r.index[name]
+	if !ok {
+		return nil, false
+	}
+
+	return r.defs[i], true
+}
+
+// At returns the i'th builtin registered, the vm refers to builtins this
+// way
+func (r *BuiltinRegistry) At(i int) *BuiltinDef {
+	return r.defs[i]
+}
+
+// Names returns the name of every builtin in the order they were registered
+func (r *BuiltinRegistry) Names() []string {
+	names := make([]string, len(r.defs))
+	for i, def := range r.defs {
+		names[i] = def.Name
+	}
+
+	return names
+}
+
+// Lookup resolves an identifier to a builtin, or to a hash of the builtins
+// in a namespace. The hash is new every time, so scripts can't change it
+// for one another.
+func (r *BuiltinRegistry) Lookup(name string) (Object, bool) {
+	if def, ok := r.Def(name); ok {
+		return def.Builtin, true
+	}
+
+	hash := NewHash()
+	for _, def := range r.defs {
+		if member, ok := strings.CutPrefix(def.Name, name+"."); ok {
+			hash.Set(&String{Value: member}, def.Builtin)
+		}
+	}
+
+	if hash.Len() == 0 {
+		return nil, false
+	}
+
+	return hash, true
+}
+
+// Clone returns a registry with the same builtins, registering in to one
+// leaves the other alone
+func (r *BuiltinRegistry) Clone() *BuiltinRegistry {
+	clone := &BuiltinRegistry{
+		defs:  make([]*BuiltinDef, len(r.defs)),
+		index: make(map[string]int, len(r.index)),
+	}
+
+	copy(clone.defs, r.defs)
+	for name, i := range r.index {
+		clone.index[name] = i
+	}
+
+	return clone
+}
+
+func invalidArgType(name string, i int, expected Types, got Object) *Error {
+	return newErrorf(TYPE_ERROR, "wrong type of argument %d for %s: want=%s, got=%s", i+1, name, expected, got.Type())
+}
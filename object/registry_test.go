@@ -0,0 +1,104 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestSignatureCheck(t *testing.T) {
+	one := &Integer{Value: 1}
+	str := &String{Value: "a"}
+
+	tests := []struct {
+		sig      *Signature
+		args     []Object
+		expected string
+	}{
+		{&Signature{}, nil, ""},
+		{&Signature{}, []Object{one}, "wrong number of arguments for f: want=0, got=1"},
+		{&Signature{Params: []Types{nil, {STRING_OBJ}}}, []Object{one, str}, ""},
+		{&Signature{Params: []Types{nil, {STRING_OBJ}}}, []Object{one}, "wrong number of arguments for f: want=2, got=1"},
+		{&Signature{Params: []Types{nil, {STRING_OBJ}}}, []Object{one, one}, "wrong type of argument 2 for f: want=STRING, got=INTEGER"},
+		{&Signature{Params: []Types{{STRING_OBJ, ARRAY_OBJ, HASH_OBJ}}}, []Object{one}, "wrong type of argument 1 for f: want=STRING, ARRAY or HASH, got=INTEGER"},
+		{&Signature{Params: []Types{{STRING_OBJ}, {INTEGER_OBJ}}, Variadic: true}, []Object{str}, ""},
+		{&Signature{Params: []Types{{STRING_OBJ}, {INTEGER_OBJ}}, Variadic: true}, []Object{str, one, one}, ""},
+		{&Signature{Params: []Types{{STRING_OBJ}, {INTEGER_OBJ}}, Variadic: true}, []Object{str, one, str}, "wrong type of argument 3 for f: want=INTEGER, got=STRING"},
+		{&Signature{Params: []Types{{STRING_OBJ}, {INTEGER_OBJ}}, Variadic: true}, nil, "wrong number of arguments for f: want at least 1, got=0"},
+	}
+
+	for _, tt := range tests {
+		err := tt.sig.Check("f", tt.args)
+
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("%+v: unexpected error %q", tt.sig, err.Message)
+		case tt.expected != "" && (err == nil || err.Message != tt.expected):
+			t.Errorf("%+v: expected error %q, got=%v", tt.sig, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	constant := func(v int64) BuiltinFunction {
+		return func(args ...Object) Object { return &Integer{Value: v} }
+	}
+
+	r := NewBuiltinRegistry()
+	r.Register("a", nil, constant(1))
+	r.Register("ns.b", nil, constant(2))
+	r.Register("ns.c", &Signature{}, constant(3))
+
+	clone := r.Clone()
+	clone.Register("a", nil, constant(4))
+	clone.Register("d", nil, constant(5))
+
+	// replacing a builtin keeps its index
+	if names := clone.Names(); len(names) != 4 || names[0] != "a" || names[3] != "d" {
+		t.Errorf("wrong names, got=%v", names)
+	}
+
+	if got := clone.At(0).Builtin.Fn().Inspect(); got != "4" {
+		t.Errorf("expected the clone's a to return 4, got=%s", got)
+	}
+
+	if got := r.At(0).Builtin.Fn().Inspect(); got != "1" {
+		t.Errorf("expected the original a to return 1, got=%s", got)
+	}
+
+	if _, ok := r.Lookup("d"); ok {
+		t.Errorf("expected d to only be registered in the clone")
+	}
+
+	ns, ok := r.Lookup("ns")
+	if !ok || ns.Type() != HASH_OBJ || ns.(*Hash).Len() != 2 {
+		t.Fatalf("expected ns to be a hash of 2 builtins, got=%+v", ns)
+	}
+
+	c, _ := ns.(*Hash).Get(&String{Value: "c"})
+	if err, ok := c.(*Builtin).Fn(TRUE).(*Error); !ok || err.Message != "wrong number of arguments for ns.c: want=0, got=1" {
+		t.Errorf("expected ns.c to check its arguments, got=%+v", err)
+	}
+
+	if def, ok := r.Def("ns.c"); !ok || def.Signature == nil {
+		t.Errorf("expected ns.c to keep its signature, got=%+v", def)
+	}
+
+	for _, name := range []string{"n", "ns.", "b"} {
+		if obj, ok := r.Lookup(name); ok {
+			t.Errorf("expected %q not to resolve, got=%+v", name, obj)
+		}
+	}
+}
+
+func TestEnviornmentBuiltins(t *testing.T) {
+	env := NewEnviornment()
+	if env.Builtins() != Builtins {
+		t.Errorf("expected the default builtins")
+	}
+
+	r := NewBuiltinRegistry()
+	env.SetBuiltins(r)
+
+	if NewEnclosedEnviornment(env).Builtins() != r {
+		t.Errorf("expected an enclosed scope to take on the builtins")
+	}
+}
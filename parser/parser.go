@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/cijin/go-interpreter/ast"
@@ -12,24 +14,62 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // =, +=, -=, *= or /=
+	NULLISH     // ??
+	OR          // ||
+	AND         // &&
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
 	EQUALS      // ==
-	LESSGREATER // > or <
+	LESSGREATER // <, >, <= or >=
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // *, / or %
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.ASTERISK: PRODUCT,
-	token.SLASH:    PRODUCT,
-	token.LPAREN:   CALL,
+	token.ASSIGN:            ASSIGN,
+	token.PLUS_ASSIGN:       ASSIGN,
+	token.MINUS_ASSIGN:      ASSIGN,
+	token.ASTERISK_ASSIGN:   ASSIGN,
+	token.SLASH_ASSIGN:      ASSIGN,
+	token.NULLISH:           NULLISH,
+	token.OR:                OR,
+	token.AND:               AND,
+	token.BIT_OR:            BIT_OR,
+	token.BIT_XOR:           BIT_XOR,
+	token.BIT_AND:           BIT_AND,
+	token.EQ:                EQUALS,
+	token.NOT_EQ:            EQUALS,
+	token.LT:                LESSGREATER,
+	token.GT:                LESSGREATER,
+	token.LT_EQ:             LESSGREATER,
+	token.GT_EQ:             LESSGREATER,
+	token.SHL:               SHIFT,
+	token.SHR:               SHIFT,
+	token.PLUS:              SUM,
+	token.MINUS:             SUM,
+	token.ASTERISK:          PRODUCT,
+	token.SLASH:             PRODUCT,
+	token.PERCENT:           PRODUCT,
+	token.LPAREN:            CALL,
+	token.LBRACKET:          INDEX,
+	token.OPTIONAL_DOT:      INDEX,
+	token.OPTIONAL_LBRACKET: INDEX,
+}
+
+// Precedence returns how tightly an infix operator binds, LOWEST for tokens
+// that aren't operators
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
 }
 
 type Parser struct {
@@ -37,6 +77,10 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 	errors    []string
+	comments  []*ast.Comment
+
+	// loops around the current statement, break & continue need one
+	loopDepth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -60,25 +104,36 @@ func (p *Parser) registerInfix(t token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return Precedence(p.curToken.Type)
 }
 
+// Errors are prefixed with the position they occured at
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+func (p *Parser) errorf(pos token.Position, format string, a ...interface{}) {
+	msg := fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, a...))
+	p.errors = append(p.errors, msg)
+}
+
+// lexError reports the error the lexer found in tok, at the position it
+// was found which may be inside the token
+func (p *Parser) lexError(tok token.Token) {
+	pos := tok.Pos
+
+	var err *lexer.Error
+	if errors.As(tok.Error, &err) {
+		pos = err.Pos
+	}
+
+	p.errorf(pos, "%s", tok.Error)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -92,15 +147,48 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
+
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	// the nil checks avoid returning a typed nil wrapped in ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.CONST:
+		if stmt := p.parseConstStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.FOR:
+		if stmt := p.parseForStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.BREAK, token.CONTINUE:
+		if stmt := p.parseBranchStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.TRY:
+		if stmt := p.parseTryStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -131,6 +219,31 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.curToken}
+
+	// ex: const x = 5;
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -145,6 +258,161 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LSQUIRLY) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LSQUIRLY) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseLoopBody parses the block of a loop, a semicolon after it is
+// allowed but not needed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth += 1
+	body := p.parseBlockStatement()
+	p.loopDepth -= 1
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body
+}
+
+func (p *Parser) parseBranchStatement() *ast.BranchStatement {
+	stmt := &ast.BranchStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if p.loopDepth == 0 {
+		p.errorf(stmt.Token.Pos, "%s outside of a loop", stmt.Token.Literal)
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	stmt := &ast.TryStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LSQUIRLY) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LSQUIRLY) {
+			return nil
+		}
+
+		stmt.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LSQUIRLY) {
+			return nil
+		}
+
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorf(p.peekToken.Pos, "expected catch or finally after try block, got %s", p.peekToken.Type)
+		return nil
+	}
+
+	// like loops, a semicolon after the last block is allowed but not needed
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -159,8 +427,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s", p.curToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken.Pos, "no prefix parse function for %s", t)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -170,9 +437,11 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 
+	// an expression that failed to parse was reported where it failed, it
+	// ends the expression rather than being built on with nil parts
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for leftExp != nil && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -198,9 +467,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err == nil {
+		lit.Value = val
+		return lit
+	}
+
+	// literals too big for an int64 are kept as big integers
+	value, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+	if !ok {
+		p.errorf(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+
+	lit.Big = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	val, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorf(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -211,13 +500,50 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 func (p *Parser) parseStringLiteral() ast.Expression {
 	if p.curToken.Error != nil {
-		p.errors = append(p.errors, p.curToken.Error.Error())
+		p.lexError(p.curToken)
 		return nil
 	}
 
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+/*
+parseInterpolatedString parses "a ${b} c", which the lexer hands over as
+the literal parts with the tokens of the embedded expressions in between.
+*/
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for {
+		if p.curToken.Error != nil {
+			p.lexError(p.curToken)
+			return nil
+		}
+
+		str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+
+		if p.curTokenIs(token.INTERP_TAIL) {
+			str.Tail = p.curToken
+			return str
+		}
+
+		if p.peekTokenIs(token.INTERP_MIDDLE) || p.peekTokenIs(token.INTERP_TAIL) {
+			p.errorf(p.peekToken.Pos, "empty expression in string interpolation")
+			return nil
+		}
+
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.INTERP_MIDDLE) && !p.peekTokenIs(token.INTERP_TAIL) {
+			p.errorf(p.peekToken.Pos, "expected } to close string interpolation, got %s", p.peekToken.Type)
+			return nil
+		}
+
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -245,6 +571,12 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.EOF) {
+		p.errorf(p.curToken.Pos, "expected next token to be %s, got %s", token.RSQUIRLY, token.EOF)
+	}
+
+	block.Rbrace = p.curToken
+
 	return block
 }
 
@@ -323,7 +655,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// loops outside the function can't be broken out of from inside it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	exp.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return exp
 }
@@ -337,6 +673,9 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	p.nextToken()
 
 	expression.Right = p.parseExpression(PREFIX)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -352,42 +691,165 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 
 	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+// assignments are right associative, a = b = 1 assigns 1 to both
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	// the target already failed to parse, which was reported
+	if target == nil {
+		return nil
+	}
 
-	if p.peekTokenIs(token.RPAREN) {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier:
+	case *ast.IndexExpression:
+		if target.Optional {
+			p.errorf(target.Pos(), "cannot assign to optional access %s", target)
+		}
+	default:
+		p.errorf(target.Pos(), "cannot assign to %s", target)
+	}
+
+	p.nextToken()
+
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
+// parses a comma separated list of expressions till the end token,
+// used by both call arguments and array literals
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return list
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	return args
+	return list
 }
 
 func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
 	ce := &ast.CallExpression{Token: p.curToken, Function: fn}
-	ce.Arguments = p.parseCallArguments()
+	ce.Arguments = p.parseExpressionList(token.RPAREN)
+	ce.Rparen = p.curToken
 
 	return ce
 }
 
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken
+
+	return array
+}
+
+/*
+ * A '{' in expression position is always a hash literal. Block statements
+ * are only parsed after `if`, `else` & `fn`, which call parseBlockStatement
+ * directly, so the two never compete for the same token.
+ */
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.peekTokenIs(token.RSQUIRLY) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RSQUIRLY) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RSQUIRLY) {
+		return nil
+	}
+
+	hash.Rbrace = p.curToken
+
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// xs?[i] is parsed like xs[i]
+func (p *Parser) parseOptionalIndexExpression(left ast.Expression) ast.Expression {
+	exp := p.parseIndexExpression(left)
+	if exp, ok := exp.(*ast.IndexExpression); ok {
+		exp.Optional = true
+	}
+
+	return exp
+}
+
+// h?.key is h?["key"], the name is taken as a string
+func (p *Parser) parseOptionalDotExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: true}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -397,8 +859,7 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken.Pos, "expected next token to be %s, got %s", t, p.peekToken.Type)
 }
 
 func (p *Parser) expectPeek(t token.TokenType) bool {
@@ -413,7 +874,25 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.readToken()
+}
+
+// readToken returns the next token that isn't a comment, comments are set
+// aside for the program
+func (p *Parser) readToken() token.Token {
+	for {
+		tok := p.l.NextToken()
+		if tok.Type != token.COMMENT {
+			return tok
+		}
+
+		if tok.Error != nil {
+			p.lexError(tok)
+			continue
+		}
+
+		p.comments = append(p.comments, &ast.Comment{Token: tok})
+	}
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -426,14 +905,21 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.RAW_STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERP_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LSQUIRLY, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -444,7 +930,26 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_LBRACKET, p.parseOptionalIndexExpression)
+	p.registerInfix(token.OPTIONAL_DOT, p.parseOptionalDotExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
 
 	return p
 }
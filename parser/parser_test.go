@@ -201,12 +201,75 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "123456789012345678901234567890;"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected ast.ExpressionStatement got=%T", program.Statements[0])
+	}
+
+	lit, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expected ast.IntegerLiteral got=%T", stmt.Expression)
+	}
+
+	if lit.Big == nil || lit.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("expected big value 123456789012345678901234567890, got=%v", lit.Big)
+	}
+
+	if lit.String() != "123456789012345678901234567890" {
+		t.Errorf("expected literal to print as written, got=%q", lit.String())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1.5e3;", 1500},
+		{"2E-2;", 0.02},
+	}
+
+	for _, tc := range tests {
+		l := lexer.New(tc.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("expected ast.ExpressionStatement got=%T", program.Statements[0])
+		}
+
+		lit, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("expected ast.FloatLiteral got=%T", stmt.Expression)
+		}
+
+		if lit.Value != tc.expected {
+			t.Errorf("expected value %g got=%g", tc.expected, lit.Value)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected string
 	}{
 		{`"hello world";`, "hello world"},
+		{`"tab\there\n";`, "tab\there\n"},
+		{"`raw\\n\nlines`;", "raw\\n\nlines"},
 	}
 
 	for _, tc := range tests {
@@ -236,6 +299,43 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringParsing(t *testing.T) {
+	input := `"Hello ${name}, you have ${n + 1} items"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("expected *ast.InterpolatedString, got=%T", stmt.Expression)
+	}
+
+	if len(str.Parts) != 5 {
+		t.Fatalf("expected 5 parts, got=%d", len(str.Parts))
+	}
+
+	for i, expected := range []string{"Hello ", ", you have ", " items"} {
+		lit, ok := str.Parts[i*2].(*ast.StringLiteral)
+		if !ok || lit.Value != expected {
+			t.Errorf("part %d wrong. expected=%q, got=%s", i*2, expected, str.Parts[i*2])
+		}
+	}
+
+	testIdentifier(t, str.Parts[1], "name")
+	testInfixExpression(t, str.Parts[3], "n", "+", 1)
+
+	if str.String() != `"Hello ${name}, you have ${(n + 1)} items"` {
+		t.Errorf("wrong String(), got=%s", str.String())
+	}
+
+	if str.End().Column != len(input)+1 {
+		t.Errorf("wrong end, got=%s", str.End())
+	}
+}
+
 func TestUnterminatedStringLiteral(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -244,9 +344,9 @@ func TestUnterminatedStringLiteral(t *testing.T) {
 		{
 			`"hello
 			"world"`, // added '"' to start of string so as to not get 2 errors
-			"string literal not terminated",
+			"1:1: string literal not terminated",
 		},
-		{`"hello world`, "string literal not terminated"},
+		{`"hello world`, "1:1: string literal not terminated"},
 	}
 
 	for _, tc := range tests {
@@ -470,6 +570,77 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		// index expressions
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		// logical and comparison operators
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && !c || d < e",
+			"(((a == b) && (!c)) || (d < e))",
+		},
+		// bitwise operators bind like they do in c
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"a << b + c < d >> e",
+			"((a << (b + c)) < (d >> e))",
+		},
+		{
+			"a && b | c",
+			"(a && (b | c))",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"a ?? b || c",
+			"(a ?? (b || c))",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"-a?.b?[c](d)",
+			`(-((a?["b"])?[c])(d))`,
+		},
+		{
+			"x = a?.b ?? null",
+			`(x = ((a?["b"]) ?? null))`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -519,6 +690,34 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	input := `const answer = 42;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ConstStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ConstStatement, got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "answer" {
+		t.Errorf("expected name answer, got=%s", stmt.Name.Value)
+	}
+
+	testLiteralExpression(t, stmt.Value, 42)
+
+	if got := stmt.String(); got != "const answer = 42;" {
+		t.Errorf("expected String() to be %q, got=%q", "const answer = 42;", got)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -652,6 +851,167 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 1 + 2", "(x = (y = (1 + 2)))"},
+		{"x += y || z", "(x += (y || z))"},
+		{"xs[0] -= 1", "((xs[0]) -= 1)"},
+		{"a[b][c] *= 2", "(((a[b])[c]) *= 2)"},
+		{"h[k] /= 2", "((h[k]) /= 2)"},
+		{"(x = 1) + 2", "((x = 1) + 2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("expected *ast.ExpressionStatement, got=%T", program.Statements[0])
+		}
+
+		if got := stmt.Expression.String(); got != tt.expected {
+			t.Errorf("expected %q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; continue }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected program.statements to have %d statements, got=%d", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("expected stmt to be *ast.WhileStatement, got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("expected body to be 3 statements, got=%d\n", len(stmt.Body.Statements))
+	}
+
+	for i, keyword := range []string{"break", "continue"} {
+		branch, ok := stmt.Body.Statements[i+1].(*ast.BranchStatement)
+		if !ok {
+			t.Fatalf("expected statement %d to be *ast.BranchStatement, got=%T", i+1, stmt.Body.Statements[i+1])
+		}
+
+		if branch.TokenLiteral() != keyword {
+			t.Errorf("expected %s, got=%s", keyword, branch.TokenLiteral())
+		}
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in [1, 2]) { x }; x`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected program.statements to have %d statements, got=%d", 2, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("expected stmt to be *ast.ForStatement, got=%T", program.Statements[0])
+	}
+
+	if stmt.Variable.Value != "x" {
+		t.Errorf("expected loop variable x, got=%s", stmt.Variable.Value)
+	}
+
+	if _, ok := stmt.Iterable.(*ast.ArrayLiteral); !ok {
+		t.Errorf("expected iterable to be *ast.ArrayLiteral, got=%T", stmt.Iterable)
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("expected body to be 1 statement, got=%d\n", len(stmt.Body.Statements))
+	}
+
+	if got := stmt.String(); got != "for (x in [1, 2]) x" {
+		t.Errorf("expected String() to be %q, got=%q", "for (x in [1, 2]) x", got)
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	input := `throw "boom"; x`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected program.statements to have %d statements, got=%d", 2, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("expected stmt to be *ast.ThrowStatement, got=%T", program.Statements[0])
+	}
+
+	if stmt.String() != `throw "boom";` {
+		t.Errorf("expected %q, got=%q", `throw "boom";`, stmt.String())
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input      string
+		param      string
+		hasCatch   bool
+		hasFinally bool
+	}{
+		{"try { a } catch (e) { b }", "e", true, false},
+		{"try { a } finally { c }", "", false, true},
+		{"try { a } catch (err) { b } finally { c }; x", "err", true, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.TryStatement)
+		if !ok {
+			t.Fatalf("expected stmt to be *ast.TryStatement, got=%T", program.Statements[0])
+		}
+
+		if len(stmt.Body.Statements) != 1 {
+			t.Errorf("expected try block to be 1 statement, got=%d", len(stmt.Body.Statements))
+		}
+
+		if (stmt.Catch != nil) != tt.hasCatch || (stmt.Finally != nil) != tt.hasFinally {
+			t.Errorf("%q: wrong blocks, catch=%t finally=%t", tt.input, stmt.Catch != nil, stmt.Finally != nil)
+		}
+
+		if tt.hasCatch && stmt.Param.Value != tt.param {
+			t.Errorf("expected catch parameter %s, got=%s", tt.param, stmt.Param.Value)
+		}
+	}
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	input := `fn(x, y) { x + y };`
 
@@ -777,3 +1137,409 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestArrayLiteralParsing(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected program statement to be *ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("expected statement expression to be *ast.ArrayLiteral, got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("expected 3 elements, got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestEmptyArrayLiteralParsing(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("expected statement expression to be *ast.ArrayLiteral, got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Fatalf("expected 0 elements, got=%d", len(array.Elements))
+	}
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected program statement to be *ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("expected statement expression to be *ast.IndexExpression, got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Left, "myArray") {
+		return
+	}
+
+	testInfixExpression(t, exp.Index, 1, "+", 1)
+}
+
+func TestOptionalIndexExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input string
+		index string
+	}{
+		{"a?[1 + 1]", "(1 + 1)"},
+		// a?.b is the same as a?["b"]
+		{"a?.b", `"b"`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("expected program statement to be *ast.ExpressionStatement, got=%T", program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.IndexExpression)
+		if !ok {
+			t.Fatalf("expected statement expression to be *ast.IndexExpression, got=%T", stmt.Expression)
+		}
+
+		if !exp.Optional {
+			t.Errorf("expected %q to be an optional index", tt.input)
+		}
+
+		if !testIdentifier(t, exp.Left, "a") {
+			return
+		}
+
+		if exp.Index.String() != tt.index {
+			t.Errorf("expected index to be %q, got=%q", tt.index, exp.Index.String())
+		}
+	}
+
+	program := New(lexer.New("a?.b")).ParseProgram()
+	index := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression).Index
+	if _, ok := index.(*ast.StringLiteral); !ok {
+		t.Errorf("expected ?.b to index with *ast.StringLiteral, got=%T", index)
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]int64
+	}{
+		{`{}`, map[string]int64{}},
+		{`{"one": 1, "two": 2, "three": 3}`, map[string]int64{"one": 1, "two": 2, "three": 3}},
+		{`{"one": 1, "two": 2,}`, map[string]int64{"one": 1, "two": 2}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("expected statement expression to be *ast.HashLiteral, got=%T", stmt.Expression)
+		}
+
+		if len(hash.Pairs) != len(tt.expected) {
+			t.Fatalf("expected %d pairs, got=%d", len(tt.expected), len(hash.Pairs))
+		}
+
+		for _, pair := range hash.Pairs {
+			key, ok := pair.Key.(*ast.StringLiteral)
+			if !ok {
+				t.Errorf("expected key to be *ast.StringLiteral, got=%T", pair.Key)
+				continue
+			}
+
+			testIntegerLiteral(t, pair.Value, tt.expected[key.Value])
+		}
+	}
+}
+
+func TestHashLiteralKeyTypesParsing(t *testing.T) {
+	input := `{1: 1, true: 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expected statement expression to be *ast.HashLiteral, got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("expected 3 pairs, got=%d", len(hash.Pairs))
+	}
+
+	testIntegerLiteral(t, hash.Pairs[0].Key, 1)
+	testBooleanLiteral(t, hash.Pairs[1].Key, true)
+
+	if _, ok := hash.Pairs[2].Key.(*ast.StringLiteral); !ok {
+		t.Errorf("expected key to be *ast.StringLiteral, got=%T", hash.Pairs[2].Key)
+	}
+}
+
+func TestHashLiteralWithExpressionsParsing(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expected statement expression to be *ast.HashLiteral, got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("expected 3 pairs, got=%d", len(hash.Pairs))
+	}
+
+	tests := []func(ast.Expression){
+		func(e ast.Expression) { testInfixExpression(t, e, 0, "+", 1) },
+		func(e ast.Expression) { testInfixExpression(t, e, 10, "-", 8) },
+		func(e ast.Expression) { testInfixExpression(t, e, 15, "/", 5) },
+	}
+
+	for i, pair := range hash.Pairs {
+		tests[i](pair.Value)
+	}
+}
+
+func TestHashLiteralInsideBlockParsing(t *testing.T) {
+	input := `if (true) { {"a": 1} }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp := stmt.Expression.(*ast.IfExpression)
+
+	inner, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ExpressionStatement, got=%T", exp.Consequence.Statements[0])
+	}
+
+	if _, ok := inner.Expression.(*ast.HashLiteral); !ok {
+		t.Fatalf("expected *ast.HashLiteral, got=%T", inner.Expression)
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT"},
+		{"add(1, 2", "1:9: expected next token to be ), got EOF"},
+		{"let x = 5;\n  let = 10;", "2:7: expected next token to be IDENT, got ="},
+		{"if (x) {\n  x", "2:4: expected next token to be }, got EOF"},
+		{"\n\n  09", `3:3: could not parse "09" as integer`},
+		{"let x = 5; /* oops", "1:12: comment not terminated"},
+		{`let s = "ab\q";`, `1:12: unknown escape sequence \q`},
+		{`"a ${} b"`, "1:6: empty expression in string interpolation"},
+		{`"a ${x y} b"`, "1:8: expected } to close string interpolation, got IDENT"},
+		{`"a ${x} b`, "1:7: string literal not terminated"},
+		{"if (x) {\n  break\n}", "2:3: break outside of a loop"},
+		{"let x = 1;\n  x + 1 = 2", "2:3: cannot assign to (x + 1)"},
+		{"f() += 1", "1:1: cannot assign to f()"},
+		{"const = 1", "1:7: expected next token to be IDENT, got ="},
+		{"while (x) { fn() { continue } }", "1:20: continue outside of a loop"},
+		{"for (1 in xs) { }", "1:6: expected next token to be IDENT, got INT"},
+		{"for (x of xs) { }", "1:8: expected next token to be IN, got IDENT"},
+		{"a?.b = 1", `1:1: cannot assign to optional access (a?["b"])`},
+		{"try { a }; b", "1:10: expected catch or finally after try block, got ;"},
+		{"try { a } catch { b }", "1:17: expected next token to be (, got {"},
+		{"try { a } catch (1) { b }", "1:18: expected next token to be IDENT, got INT"},
+		{"a?.1", "1:4: expected next token to be IDENT, got INT"},
+		// the target of an assignment failing to parse isn't reported twice
+		{"let fn = 1;", "1:5: expected next token to be IDENT, got FUNCTION"},
+		{"let if = 1;", "1:5: expected next token to be IDENT, got IF"},
+		{`: < ( -= /= "a${x}b" /`, "1:1: no prefix parse function for :"},
+		{"-= 1", "1:1: no prefix parse function for -="},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected errors for %q, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("expected error to be %q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+// the optional semicolon after a misplaced break or continue is part of it,
+// not the start of another error
+func TestBranchOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"let x = 1; continue; x", "1:12: continue outside of a loop"},
+		{"while (x) { fn() { break; } }", "1:20: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("%q: expected only error %q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// adds two numbers
+let add = fn(a, b) {
+  a /* left */ + b // right
+};`
+
+	for _, keep := range []bool{false, true} {
+		l := lexer.New(input)
+		if keep {
+			l.KeepComments()
+		}
+
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		if program.String() != "let add = fn(a, b)(a + b);" {
+			t.Errorf("comments changed the program, got=%q", program.String())
+		}
+
+		if !keep {
+			if len(program.Comments) != 0 {
+				t.Errorf("expected no comments, got=%d", len(program.Comments))
+			}
+			continue
+		}
+
+		expected := []struct {
+			text string
+			pos  string
+		}{
+			{"// adds two numbers", "1:1"},
+			{"/* left */", "3:5"},
+			{"// right", "3:20"},
+		}
+
+		if len(program.Comments) != len(expected) {
+			t.Fatalf("expected %d comments, got=%d", len(expected), len(program.Comments))
+		}
+
+		for i, c := range expected {
+			if program.Comments[i].String() != c.text || program.Comments[i].Pos().String() != c.pos {
+				t.Errorf("comment[%d] wrong. expected=%q at %s, got=%q at %s", i, c.text, c.pos, program.Comments[i], program.Comments[i].Pos())
+			}
+		}
+	}
+}
+
+func TestParserErrorFilename(t *testing.T) {
+	l := lexer.NewFile("main.mk", "let = 1;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected errors, got none")
+	}
+
+	expected := "main.mk:1:5: expected next token to be IDENT, got ="
+	if errors[0] != expected {
+		t.Errorf("expected error to be %q, got=%q", expected, errors[0])
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y
+};
+add(1, [2][0])`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node     ast.Node
+		pos, end string
+	}{
+		{program, "1:1", "4:15"},
+		{program.Statements[0], "1:1", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11", "3:2"},
+		{program.Statements[1], "4:1", "4:15"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "4:8", "4:14"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.pos {
+			t.Errorf("[tc %d]: expected pos %s, got=%s", i, tt.pos, tt.node.Pos())
+		}
+
+		if tt.node.End().String() != tt.end {
+			t.Errorf("[tc %d]: expected end %s, got=%s", i, tt.end, tt.node.End())
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// errInterrupt is returned by ReadLine when ctrl-c throws away the line
+var errInterrupt = errors.New("interrupted")
+
+// lineReader reads input one line at a time, io.EOF ends the session
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// scanReader is used when input is not a terminal, say a pipe or a test
+type scanReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (s *scanReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(s.out, prompt)
+
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.EOF
+	}
+
+	return s.scanner.Text(), nil
+}
+
+func (s *scanReader) Close() error {
+	return nil
+}
+
+/*
+editor is a small line editor for terminals in raw mode. It understands the
+arrow keys, home/end, the usual emacs control keys, history recall and tab
+completion. The terminal is only switched to raw mode while a line is being
+read so ctrl-c still interrupts a running program.
+*/
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  *History
+	complete func(prefix string) []string
+
+	// raw switches the terminal to raw mode, it returns a function
+	// restoring the previous mode
+	raw func() (func() error, error)
+	// called on Close, used to save the history
+	close func() error
+
+	prompt    string
+	buf       []rune
+	cursor    int
+	histIndex int
+	histSaved string // the line being edited before walking the history
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt = prompt
+	e.buf = e.buf[:0]
+	e.cursor = 0
+	e.histIndex = e.history.Len()
+	e.histSaved = ""
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			line := string(e.buf)
+			io.WriteString(e.out, "\r\n")
+			e.history.Add(line)
+
+			return line, nil
+
+		case ctrl('c'):
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupt
+
+		case ctrl('d'):
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+
+			e.delete()
+
+		case ctrl('a'):
+			e.cursor = 0
+
+		case ctrl('e'):
+			e.cursor = len(e.buf)
+
+		case ctrl('b'):
+			e.moveCursor(-1)
+
+		case ctrl('f'):
+			e.moveCursor(1)
+
+		case ctrl('p'):
+			e.historyMove(-1)
+
+		case ctrl('n'):
+			e.historyMove(1)
+
+		case ctrl('k'):
+			e.buf = e.buf[:e.cursor]
+
+		case ctrl('u'):
+			e.buf = append(e.buf[:0], e.buf[e.cursor:]...)
+			e.cursor = 0
+
+		case ctrl('h'), 127:
+			if e.cursor > 0 {
+				e.cursor -= 1
+				e.delete()
+			}
+
+		case '\t':
+			e.completeWord()
+
+		case 27:
+			if err := e.escape(); err != nil {
+				return "", err
+			}
+
+		default:
+			if r >= ' ' {
+				e.insert(string(r))
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+func (e *editor) Close() error {
+	if e.close != nil {
+		return e.close()
+	}
+
+	return nil
+}
+
+func ctrl(key rune) rune {
+	return key & 0x1f
+}
+
+// escape handles the sequences sent for arrow, home, end and delete keys,
+// like "\x1b[A" or "\x1b[3~", anything else is ignored
+func (e *editor) escape() error {
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return err
+	}
+
+	if next != '[' && next != 'O' {
+		return nil
+	}
+
+	var param strings.Builder
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return err
+		}
+
+		if r >= '0' && r <= '9' || r == ';' {
+			param.WriteRune(r)
+			continue
+		}
+
+		switch r {
+		case 'A':
+			e.historyMove(-1)
+		case 'B':
+			e.historyMove(1)
+		case 'C':
+			e.moveCursor(1)
+		case 'D':
+			e.moveCursor(-1)
+		case 'H':
+			e.cursor = 0
+		case 'F':
+			e.cursor = len(e.buf)
+		case '~':
+			switch param.String() {
+			case "1", "7":
+				e.cursor = 0
+			case "4", "8":
+				e.cursor = len(e.buf)
+			case "3":
+				e.delete()
+			}
+		}
+
+		return nil
+	}
+}
+
+// refresh redraws the line and puts the cursor back in place
+func (e *editor) refresh() {
+	var b strings.Builder
+
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(string(e.buf))
+	b.WriteString("\x1b[K")
+
+	if n := len(e.buf) - e.cursor; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", n)
+	}
+
+	io.WriteString(e.out, b.String())
+}
+
+func (e *editor) insert(s string) {
+	runes := []rune(s)
+
+	buf := make([]rune, 0, len(e.buf)+len(runes))
+	buf = append(buf, e.buf[:e.cursor]...)
+	buf = append(buf, runes...)
+	buf = append(buf, e.buf[e.cursor:]...)
+
+	e.buf = buf
+	e.cursor += len(runes)
+}
+
+// delete removes the character under the cursor
+func (e *editor) delete() {
+	if e.cursor < len(e.buf) {
+		e.buf = append(e.buf[:e.cursor], e.buf[e.cursor+1:]...)
+	}
+}
+
+func (e *editor) moveCursor(delta int) {
+	cursor := e.cursor + delta
+	if cursor >= 0 && cursor <= len(e.buf) {
+		e.cursor = cursor
+	}
+}
+
+// historyMove walks the history, going past the newest entry brings back
+// whatever was typed before walking started
+func (e *editor) historyMove(delta int) {
+	i := e.histIndex + delta
+	if i < 0 || i > e.history.Len() {
+		return
+	}
+
+	if e.histIndex == e.history.Len() {
+		e.histSaved = string(e.buf)
+	}
+
+	e.histIndex = i
+
+	line := e.histSaved
+	if i < e.history.Len() {
+		line = e.history.At(i)
+	}
+
+	e.buf = []rune(line)
+	e.cursor = len(e.buf)
+}
+
+/*
+completeWord completes the identifier in front of the cursor. A single
+match is inserted, several matches are completed up to their common prefix,
+and if that doesn't add anything they are listed under the line.
+*/
+func (e *editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+
+	start := e.cursor
+	for start > 0 && isIdentRune(e.buf[start-1]) {
+		start -= 1
+	}
+
+	prefix := string(e.buf[start:e.cursor])
+	if prefix == "" {
+		return
+	}
+
+	matches := e.complete(prefix)
+	if len(matches) == 0 {
+		return
+	}
+
+	common := commonPrefix(matches)
+	if len(common) > len(prefix) {
+		e.insert(common[len(prefix):])
+		return
+	}
+
+	if len(matches) > 1 {
+		io.WriteString(e.out, "\r\n"+strings.Join(matches, "  ")+"\r\n")
+	}
+}
+
+// isIdentRune matches the characters the lexer allows in identifiers
+func isIdentRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
+
+// completions returns the sorted names starting with prefix, names seen
+// more than once are only returned once
+func completions(prefix string, names ...[]string) []string {
+	seen := make(map[string]bool)
+	var matches []string
+
+	for _, list := range names {
+		for _, name := range list {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				matches = append(matches, name)
+			}
+		}
+	}
+
+	sort.Strings(matches)
+	return matches
+}
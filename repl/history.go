@@ -0,0 +1,87 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	HISTORY_FILE = ".monkey_history"
+	HISTORY_SIZE = 1000
+)
+
+// History holds previously entered lines, oldest first, one entry per line
+// of input so multi-line functions can be recalled piece by piece
+type History struct {
+	lines []string
+}
+
+// historyPath returns the history dotfile in the home directory
+func historyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, HISTORY_FILE), nil
+}
+
+// LoadHistory reads the history saved at path, a missing file is an empty
+// history
+func LoadHistory(path string) (*History, error) {
+	h := &History{}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.Add(scanner.Text())
+	}
+
+	return h, scanner.Err()
+}
+
+// Add appends line, skipping blank lines and repeats of the last entry
+func (h *History) Add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return
+	}
+
+	h.lines = append(h.lines, line)
+	if len(h.lines) > HISTORY_SIZE {
+		h.lines = h.lines[len(h.lines)-HISTORY_SIZE:]
+	}
+}
+
+func (h *History) Len() int {
+	return len(h.lines)
+}
+
+// At returns the i-th entry, 0 being the oldest
+func (h *History) At(i int) string {
+	return h.lines[i]
+}
+
+// Save writes the history to path, replacing what was there
+func (h *History) Save(path string) error {
+	var b strings.Builder
+	for _, line := range h.lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
@@ -0,0 +1,39 @@
+package repl
+
+import (
+	"errors"
+
+	"github.com/cijin/go-interpreter/lexer"
+	"github.com/cijin/go-interpreter/token"
+)
+
+// IsIncomplete reports whether src needs more lines before it can be parsed,
+// that is when a '(', '[' or '{' is still open, or a string literal or a
+// block comment runs into the end of the input
+func IsIncomplete(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+
+	for {
+		tok := l.NextToken()
+
+		switch tok.Type {
+		case token.EOF:
+			return depth > 0
+
+		case token.LPAREN, token.LBRACKET, token.LSQUIRLY, token.INTERP_HEAD:
+			depth += 1
+
+		case token.RPAREN, token.RBRACKET, token.RSQUIRLY, token.INTERP_TAIL:
+			depth -= 1
+
+		default:
+			// a string or comment running into the end of input can be
+			// completed, anything else wrong is for the parser to report
+			var err *lexer.Error
+			if errors.As(tok.Error, &err) {
+				return err.EOF
+			}
+		}
+	}
+}
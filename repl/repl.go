@@ -2,8 +2,9 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/cijin/go-interpreter/evaluator"
 	"github.com/cijin/go-interpreter/lexer"
@@ -12,8 +13,9 @@ import (
 )
 
 const (
-	PROMPT      = ">> "
-	MONKEY_FACE = `            __,__
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. "
+	MONKEY_FACE         = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
  | |  '|  /   Y   \  |'  | |
@@ -28,19 +30,25 @@ const (
 )
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	builtins := object.Builtins.Clone()
+	builtins.SetOutput(out)
+
 	env := object.NewEnviornment()
+	env.SetBuiltins(builtins)
 
-	for {
-		fmt.Fprintf(out, PROMPT)
+	reader := newLineReader(in, out, env)
+	defer reader.Close()
 
-		scanned := scanner.Scan()
-		if !scanned {
+	for {
+		src, err := readInput(reader)
+		if err == errInterrupt {
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		l := lexer.New(src)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
@@ -50,13 +58,81 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
+		if err, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, err.Traceback())
+			io.WriteString(out, "\n")
+		} else if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
 
+// readInput reads lines until they form a complete program. An empty line
+// or the end of input hands over what there is so far, letting the parser
+// report what is wrong with it
+func readInput(r lineReader) (string, error) {
+	src, err := r.ReadLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
+
+	for IsIncomplete(src) {
+		line, err := r.ReadLine(CONTINUATION_PROMPT)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+
+		src += "\n" + line
+	}
+
+	return src, nil
+}
+
+// newLineReader uses the line editor when in is a terminal, otherwise
+// input is read line by line as is
+func newLineReader(in io.Reader, out io.Writer, env *object.Enviornment) lineReader {
+	f, ok := in.(*os.File)
+	if !ok || !isTerminal(int(f.Fd())) {
+		return &scanReader{scanner: bufio.NewScanner(in), out: out}
+	}
+
+	e := &editor{
+		in:       bufio.NewReader(f),
+		out:      out,
+		history:  &History{},
+		complete: completer(env),
+		raw:      func() (func() error, error) { return makeRaw(int(f.Fd())) },
+	}
+
+	// history is a nicety, the repl works fine without it
+	if path, err := historyPath(); err == nil {
+		if h, err := LoadHistory(path); err == nil {
+			e.history = h
+		}
+
+		e.close = func() error { return e.history.Save(path) }
+	}
+
+	return e
+}
+
+// completer completes identifiers bound in env as well as builtin names
+func completer(env *object.Enviornment) func(string) []string {
+	builtins := env.Builtins().Names()
+
+	return func(prefix string) []string {
+		return completions(prefix, env.Names(), builtins)
+	}
+}
+
 func printParseErrors(out io.Writer, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Parser errors:\n")
@@ -0,0 +1,186 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cijin/go-interpreter/object"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", false},
+		{"let x = 5;", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) {\nreturn a + b;", true},
+		{"let add = fn(a, b) {\nreturn a + b;\n};", false},
+		{"add(1,", true},
+		{"[1, 2,", true},
+		{`{"a": 1`, true},
+		{`"hello`, true},
+		{"let s = \"hello\nworld\";", false},
+		{"}", false},
+		{"let x = 5; /* a comment", true},
+		{"let x = 5; /* a comment */", false},
+		{"let f = fn() { // {", true},
+		{"let s = `raw\nstring", true},
+		{`let s = "a ${fn(x) {`, true},
+		{`let s = "a ${x} b";`, false},
+		{"let s = `raw\nstring`;", false},
+		{`let s = "\q"; let t = "`, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsIncomplete(tt.input); got != tt.expected {
+			t.Errorf("IsIncomplete(%q) wrong. expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartMultiLine(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1,
+2)
+let broken = fn() {
+
+5 * 5
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	got := out.String()
+
+	if !strings.Contains(got, PROMPT+CONTINUATION_PROMPT+CONTINUATION_PROMPT+PROMPT) {
+		t.Errorf("expected continuation prompts, got=%q", got)
+	}
+
+	if !strings.Contains(got, "3\n") {
+		t.Errorf("expected multi-line call to evaluate to 3, got=%q", got)
+	}
+
+	if !strings.Contains(got, "Parser errors:") {
+		t.Errorf("expected an empty line to give up on incomplete input, got=%q", got)
+	}
+
+	if !strings.HasSuffix(got, "25\n"+PROMPT) {
+		t.Errorf("expected to keep going after a parse error, got=%q", got)
+	}
+}
+
+func TestStartOutput(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("puts(\"hi\")\n"), &out)
+
+	if !strings.Contains(out.String(), PROMPT+"hi\nnull\n") {
+		t.Errorf("expected puts to print to the repl's output, got=%q", out.String())
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("missing history file should not be an error, got=%s", err)
+	}
+
+	for _, line := range []string{"let a = 1;", "", "a", "a", "  ", "a + 1"} {
+		h.Add(line)
+	}
+
+	if err := h.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"let a = 1;", "a", "a + 1"}
+	if loaded.Len() != len(expected) {
+		t.Fatalf("history has wrong length. expected=%d, got=%d", len(expected), loaded.Len())
+	}
+
+	for i, line := range expected {
+		if loaded.At(i) != line {
+			t.Errorf("history[%d] wrong. expected=%q, got=%q", i, line, loaded.At(i))
+		}
+	}
+}
+
+func TestEditor(t *testing.T) {
+	env := object.NewEnviornment()
+	env.Set("counter", &object.Integer{Value: 1})
+	env.Set("count", &object.Integer{Value: 2})
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"let x = 5;\r", "let x = 5;"},
+		// left arrow then insert
+		{"ac\x1b[Db\r", "abc"},
+		// home and end
+		{"bc\x01a\x05d\r", "abcd"},
+		// backspace and delete key
+		{"abxc\x7f\x7fc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+		// kill to end of line and to start of line
+		{"abcd\x02\x02\x0b\r", "ab"},
+		{"abcd\x02\x02\x15\r", "cd"},
+		// up arrow recalls the previous line
+		{"\x1b[A\r", "cd"},
+		{"\x1b[A\x1b[A\r", "ab"},
+		// going past the newest entry brings back the edited line
+		{"new\x1b[A\x1b[B\r", "new"},
+		// completion of builtins and environment names
+		{"le\t(x)\r", "len(x)"},
+		{"cou\t\r", "count"},
+		{"counte\t\r", "counter"},
+		{"zzz\t\r", "zzz"},
+	}
+
+	history := &History{}
+	for _, tt := range tests {
+		e := &editor{
+			in:       bufioReader(tt.keys),
+			out:      io.Discard,
+			history:  history,
+			complete: completer(env),
+		}
+
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+		}
+
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorControlKeys(t *testing.T) {
+	e := &editor{in: bufioReader("abc\x03\x04"), out: io.Discard, history: &History{}}
+
+	if _, err := e.ReadLine(PROMPT); err != errInterrupt {
+		t.Errorf("expected ctrl-c to interrupt, got=%v", err)
+	}
+
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("expected ctrl-d on an empty line to be EOF, got=%v", err)
+	}
+}
+
+func bufioReader(s string) *bufio.Reader {
+	return bufio.NewReader(strings.NewReader(s))
+}
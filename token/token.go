@@ -1,11 +1,42 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
 	Error   error
+	Pos     Position // first character of the token
+	End     Position // first character after the token
+}
+
+// Position in the source, lines & columns start at 1 while the byte
+// offset starts at 0. The zero value is an invalid position.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+
+		return "-"
+	}
+
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -14,8 +45,20 @@ const (
 
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
+	RAW_STRING = "RAW_STRING"
+
+	// the literal parts of an interpolated string, "a ${b} c ${d} e" is
+	// lexed as INTERP_HEAD "a ", b, INTERP_MIDDLE " c ", d, INTERP_TAIL " e"
+	INTERP_HEAD   = "INTERP_HEAD"
+	INTERP_MIDDLE = "INTERP_MIDDLE"
+	INTERP_TAIL   = "INTERP_TAIL"
+
+	// only produced when the lexer is asked to keep comments
+	COMMENT = "COMMENT"
+
 	// operators
 	ASSIGN   = "="
 	EQ       = "=="
@@ -25,36 +68,83 @@ const (
 	NOT_EQ   = "!="
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
+	AND      = "&&"
+	OR       = "||"
+	BIT_AND  = "&"
+	BIT_OR   = "|"
+	BIT_XOR  = "^"
+	BIT_NOT  = "~"
+	SHL      = "<<"
+	SHR      = ">>"
+
+	// null coalescing & optional access, a?.b is a?["b"]
+	NULLISH           = "??"
+	OPTIONAL_DOT      = "?."
+	OPTIONAL_LBRACKET = "?["
+
+	// assignment operators, ASSIGN on its own is also used by let
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	// delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LPAREN   = "("
 	RPAREN   = ")"
 	LSQUIRLY = "{"
 	RSQUIRLY = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	// keywords
 	LET      = "LET"
+	CONST    = "CONST"
 	FUNCTION = "FUNCTION"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	NULL     = "NULL"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"if":       IF,
+	"else":     ELSE,
+	"true":     TRUE,
+	"false":    FALSE,
+	"null":     NULL,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 }
 
 func LookupIdent(ident string) TokenType {
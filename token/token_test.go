@@ -0,0 +1,21 @@
+package token
+
+import "testing"
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{}, "-"},
+		{Position{Filename: "main.mk"}, "main.mk"},
+		{Position{Line: 3, Column: 7}, "3:7"},
+		{Position{Filename: "main.mk", Line: 3, Column: 7}, "main.mk:3:7"},
+	}
+
+	for _, tt := range tests {
+		if tt.pos.String() != tt.expected {
+			t.Errorf("expected %s, got=%s", tt.expected, tt.pos.String())
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package vm
+
+import "github.com/cijin/go-interpreter/object"
+
+/*
+cell holds a local that a closure captured. The slot of the local and the
+closure's free variable both point at the same cell, so an assignment
+through either is seen by the other, the way a closure shares its
+enviornment with the function it was made in for the evaluator. Cells are
+never handed to scripts, reading a local or free variable unwraps them.
+*/
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
+
+// deref gives the value in obj if it is a cell, obj otherwise
+func deref(obj object.Object) object.Object {
+	if c, ok := obj.(*cell); ok {
+		return c.value
+	}
+
+	return obj
+}
@@ -0,0 +1,996 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/cijin/go-interpreter/code"
+	"github.com/cijin/go-interpreter/compiler"
+	"github.com/cijin/go-interpreter/object"
+	"github.com/cijin/go-interpreter/token"
+)
+
+// the stack has room for every frame to hold a few locals & temporaries,
+// so running out of frames is what usually stops deep recursion
+const (
+	MaxFrames   = 1024
+	StackSize   = 16 * MaxFrames
+	GlobalsSize = 65536
+)
+
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+// operators as they are written in source, used in error messages so
+// they read the same as the ones from the evaluator
+var operators = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpBitAnd:             "&",
+	code.OpBitOr:              "|",
+	code.OpBitXor:             "^",
+	code.OpShiftLeft:          "<<",
+	code.OpShiftRight:         ">>",
+	code.OpGreaterThan:        ">",
+	code.OpLessThan:           "<",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThanOrEqual:    "<=",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+}
+
+// bitwise operators only work on integers, so floats don't promote them
+var bitwiseOperators = map[code.Opcode]bool{
+	code.OpBitAnd:     true,
+	code.OpBitOr:      true,
+	code.OpBitXor:     true,
+	code.OpShiftLeft:  true,
+	code.OpShiftRight: true,
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	builtins    *object.BuiltinRegistry
+
+	// where the globals declared with const were declared
+	constGlobals map[int]token.Position
+
+	stack []object.Object
+	sp    int // always points to the next free slot, top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	// set up by OpTry, innermost last
+	handlers []handler
+
+	checked bool // integer overflow is an error rather than growing a big integer
+}
+
+// handler is where an error goes to, with the frame & stack it has to be
+// unwound to first
+type handler struct {
+	ip          int
+	framesIndex int
+	sp          int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.Globals,
+		builtins:    bytecode.Builtins,
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		frames:      frames,
+		framesIndex: 1,
+
+		constGlobals: bytecode.ConstGlobals,
+	}
+}
+
+// NewWithGlobalsStore shares globals between runs, see compiler.NewWithState
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+
+	return vm
+}
+
+func NewGlobalsStore() []object.Object {
+	return make([]object.Object, GlobalsSize)
+}
+
+// CheckArithmetic turns integer overflow on + - * / in to an error
+func (vm *VM) CheckArithmetic(on bool) {
+	vm.checked = on
+}
+
+// LastPoppedStackElem is the value of the last expression statement run
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) *object.Error {
+	if vm.framesIndex >= MaxFrames {
+		return newErrorf(object.RUNTIME_ERROR, "stack overflow")
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run returns runtime errors as *object.Error
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ip := frame.ip
+		ins := frame.Instructions()
+		op := code.Opcode(ins[ip])
+
+		err := vm.execute(frame, ins, op)
+		if err == errHalt {
+			return nil
+		}
+
+		if err != nil {
+			// errors happen at the instruction that was executing in the
+			// frame that was current when it started
+			if !err.Pos.IsValid() {
+				err.Pos = frame.cl.Fn.Positions[ip]
+			}
+
+			if vm.handle(err, frame) {
+				continue
+			}
+
+			err.Frames = append(err.Frames, vm.callFrames(frame, 0)...)
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+handle hands err to the innermost handler, reporting false if there is
+none. The frames unwound on the way are added to the error, the rest are
+added if it is thrown on from there.
+*/
+func (vm *VM) handle(err *object.Error, frame *Frame) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	err.Frames = append(err.Frames, vm.callFrames(frame, h.framesIndex-1)...)
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+
+	// there is room, the stack is back to where it was at the OpTry
+	vm.push(err)
+
+	return true
+}
+
+// callFrames lists the calls that lead up to frame from the frame at index
+// stop, innermost first, the same way the evaluator collects them as an
+// error unwinds
+func (vm *VM) callFrames(frame *Frame, stop int) []object.Frame {
+	i := vm.framesIndex - 1
+	for i > 0 && vm.frames[i] != frame {
+		i--
+	}
+
+	var frames []object.Frame
+	for ; i > stop; i-- {
+		caller := vm.frames[i-1]
+
+		// the caller is left on the operand of its OpCall
+		frames = append(frames, object.Frame{
+			Function: vm.frames[i].cl.Fn.Name,
+			Pos:      caller.cl.Fn.Positions[caller.ip-1],
+		})
+	}
+
+	return frames
+}
+
+// returned by execute when a return statement at the top level ends the
+// program early
+var errHalt = &object.Error{Message: "halt"}
+
+func (vm *VM) execute(frame *Frame, ins code.Instructions, op code.Opcode) *object.Error {
+	ip := frame.ip
+
+	switch op {
+	case code.OpConstant:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		frame.ip += 2
+
+		return vm.push(vm.constants[constIndex])
+
+	case code.OpPop:
+		vm.pop()
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpGreaterThanOrEqual, code.OpLessThanOrEqual:
+		return vm.executeBinaryOperation(op)
+
+	case code.OpTrue:
+		return vm.push(True)
+
+	case code.OpFalse:
+		return vm.push(False)
+
+	case code.OpNull:
+		return vm.push(Null)
+
+	case code.OpBang:
+		return vm.executeBangOperator()
+
+	case code.OpMinus:
+		return vm.executeMinusOperator()
+
+	case code.OpBitNot:
+		return vm.executeBitNotOperator()
+
+	case code.OpJump:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip = pos - 1
+
+	case code.OpJumpNotTruthy:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		condition := vm.pop()
+		if !isTruthy(condition) {
+			frame.ip = pos - 1
+		}
+
+	case code.OpJumpNull:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		if vm.stack[vm.sp-1] == Null {
+			frame.ip = pos - 1
+		}
+
+	case code.OpIterator:
+		iterable := vm.pop()
+
+		iterator, ok := object.NewIterator(iterable)
+		if !ok {
+			return newErrorf(object.TYPE_ERROR, "cannot iterate over %s", iterable.Type())
+		}
+
+		return vm.push(iterator)
+
+	case code.OpIterNext:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		iterator := vm.pop().(*object.Iterator)
+
+		item, ok := iterator.Next()
+		if !ok {
+			frame.ip = pos - 1
+			return nil
+		}
+
+		return vm.push(item)
+
+	case code.OpTry:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		vm.handlers = append(vm.handlers, handler{ip: pos, framesIndex: vm.framesIndex, sp: vm.sp})
+
+	case code.OpPopTry:
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	case code.OpThrow:
+		return object.Thrown(vm.pop())
+
+	case code.OpCatch:
+		err := vm.pop().(*object.Error)
+		return vm.push(err.Caught())
+
+	case code.OpRaise:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		frame.ip += 2
+
+		// a new error every time, raising one adds to its position & frames
+		err := vm.constants[constIndex].(*object.Error)
+		return newErrorf(err.Kind, "%s", err.Message)
+
+	case code.OpSetGlobal:
+		globalIndex := code.ReadUint16(ins[ip+1:])
+		frame.ip += 2
+
+		vm.globals[globalIndex] = vm.pop()
+
+	case code.OpAssignGlobal:
+		globalIndex := code.ReadUint16(ins[ip+1:])
+		frame.ip += 2
+
+		if vm.globals[globalIndex] == nil {
+			return newErrorf(object.NAME_ERROR, "identifier is undefined: %s", vm.globalName(int(globalIndex)))
+		}
+
+		// the compiler catches the rest, this is for functions assigning
+		// to a global that is declared as a constant after them
+		if pos, ok := vm.constGlobals[int(globalIndex)]; ok {
+			return newErrorf(object.NAME_ERROR, "cannot assign to const %s (declared at %s)", vm.globalName(int(globalIndex)), pos)
+		}
+
+		vm.globals[globalIndex] = vm.pop()
+
+	case code.OpGetGlobal:
+		globalIndex := code.ReadUint16(ins[ip+1:])
+		frame.ip += 2
+
+		global := vm.globals[globalIndex]
+		if global == nil {
+			return newErrorf(object.NAME_ERROR, "identifier is undefined: %s", vm.globalName(int(globalIndex)))
+		}
+
+		return vm.push(global)
+
+	case code.OpSetLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		slot := &vm.stack[frame.basePointer+int(localIndex)]
+		if c, ok := (*slot).(*cell); ok {
+			c.value = vm.pop()
+		} else {
+			*slot = vm.pop()
+		}
+
+	case code.OpGetLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		return vm.push(deref(vm.stack[frame.basePointer+int(localIndex)]))
+
+	case code.OpCaptureLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		slot := &vm.stack[frame.basePointer+int(localIndex)]
+		if _, ok := (*slot).(*cell); !ok {
+			*slot = &cell{value: *slot}
+		}
+
+		return vm.push(*slot)
+
+	case code.OpGetBuiltin:
+		builtinIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		return vm.push(vm.builtins.At(int(builtinIndex)).Builtin)
+
+	case code.OpGetFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		return vm.push(deref(frame.cl.Free[freeIndex]))
+
+	case code.OpSetFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		if c, ok := frame.cl.Free[freeIndex].(*cell); ok {
+			c.value = vm.pop()
+		} else {
+			frame.cl.Free[freeIndex] = vm.pop()
+		}
+
+	case code.OpCaptureFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		return vm.push(frame.cl.Free[freeIndex])
+
+	case code.OpCurrentClosure:
+		return vm.push(frame.cl)
+
+	case code.OpArray:
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		array := vm.buildArray(vm.sp-numElements, vm.sp)
+		vm.sp = vm.sp - numElements
+
+		return vm.push(array)
+
+	case code.OpHash:
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+		if err != nil {
+			return err
+		}
+		vm.sp = vm.sp - numElements
+
+		return vm.push(hash)
+
+	case code.OpInterpolate:
+		numParts := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		str := vm.buildString(vm.sp-numParts, vm.sp)
+		vm.sp = vm.sp - numParts
+
+		return vm.push(str)
+
+	case code.OpIndex:
+		index := vm.pop()
+		left := vm.pop()
+
+		return vm.executeIndexExpression(left, index)
+
+	case code.OpSetIndex:
+		value := vm.pop()
+		index := vm.pop()
+		left := vm.pop()
+
+		return vm.executeIndexAssignment(left, index, value)
+
+	case code.OpDup2:
+		if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+			return err
+		}
+
+		return vm.push(vm.stack[vm.sp-2])
+
+	case code.OpCall:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		frame.ip += 1
+
+		return vm.executeCall(int(numArgs))
+
+	case code.OpReturnValue:
+		returnValue := vm.pop()
+
+		// a return at the top level ends the program, popping left the
+		// value in place for LastPoppedStackElem
+		if vm.framesIndex == 1 {
+			return errHalt
+		}
+
+		returning := vm.popFrame()
+		vm.sp = returning.basePointer - 1
+
+		return vm.push(returnValue)
+
+	case code.OpReturn:
+		returning := vm.popFrame()
+		vm.sp = returning.basePointer - 1
+
+		return vm.push(Null)
+
+	case code.OpClosure:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		numFree := code.ReadUint8(ins[ip+3:])
+		frame.ip += 3
+
+		return vm.pushClosure(int(constIndex), int(numFree))
+
+	default:
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			return newErrorf(object.RUNTIME_ERROR, "%s", err)
+		}
+
+		return newErrorf(object.RUNTIME_ERROR, "unhandled opcode %s", def.Name)
+	}
+
+	return nil
+}
+
+func newErrorf(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+
+	return fmt.Sprintf("global %d", index)
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= StackSize {
+		return newErrorf(object.RUNTIME_ERROR, "stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+
+	return o
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(v bool) *object.Boolean {
+	if v {
+		return True
+	}
+
+	return False
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+	operator := operators[op]
+
+	if l, r, ok := object.Promote(left, right); ok && !bitwiseOperators[op] {
+		return vm.executeFloatBinaryOperation(op, l, r)
+	}
+
+	switch {
+	// anything can be compared with null, so x == null works for any x
+	case (left == Null || right == Null) && (op == code.OpEqual || op == code.OpNotEqual):
+		return vm.push(nativeBoolToBooleanObject((left == right) == (op == code.OpEqual)))
+
+	case leftType != rightType:
+		return newErrorf(object.TYPE_ERROR, "type mismatch: %s %s %s", leftType, operator, rightType)
+
+	case leftType == object.INTEGER_OBJ:
+		return vm.executeIntegerBinaryOperation(op, left, right)
+
+	case leftType == object.STRING_OBJ:
+		return vm.executeStringBinaryOperation(op, left, right)
+
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s %s %s", leftType, operator, rightType)
+	}
+}
+
+// executeIntegerBinaryOperation switches to big integers when a result
+// doesn't fit in an int64, unless arithmetic is checked
+func (vm *VM) executeIntegerBinaryOperation(op code.Opcode, left, right object.Object) *object.Error {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if !lok || !rok {
+		return vm.executeBigIntBinaryOperation(op, left, right)
+	}
+
+	leftValue, rightValue := l.Value, r.Value
+
+	var (
+		value int64
+		ok    bool
+	)
+
+	switch op {
+	case code.OpAdd:
+		value, ok = object.AddInt64(leftValue, rightValue)
+	case code.OpSub:
+		value, ok = object.SubInt64(leftValue, rightValue)
+	case code.OpMul:
+		value, ok = object.MulInt64(leftValue, rightValue)
+	case code.OpDiv:
+		if rightValue == 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "division by zero")
+		}
+		value, ok = object.DivInt64(leftValue, rightValue)
+	case code.OpMod:
+		if rightValue == 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "division by zero")
+		}
+		value, ok = leftValue%rightValue, true
+
+	case code.OpBitAnd:
+		value, ok = leftValue&rightValue, true
+	case code.OpBitOr:
+		value, ok = leftValue|rightValue, true
+	case code.OpBitXor:
+		value, ok = leftValue^rightValue, true
+	case code.OpShiftLeft:
+		if rightValue < 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "negative shift count: %d", rightValue)
+		}
+		value, ok = object.ShlInt64(leftValue, rightValue)
+	case code.OpShiftRight:
+		if rightValue < 0 {
+			return newErrorf(object.ARITHMETIC_ERROR, "negative shift count: %d", rightValue)
+		}
+		value, ok = leftValue>>rightValue, true
+
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s", operators[op])
+	}
+
+	if !ok {
+		if vm.checked {
+			return newErrorf(object.ARITHMETIC_ERROR, "integer overflow: %d %s %d", leftValue, operators[op], rightValue)
+		}
+
+		return vm.executeBigIntBinaryOperation(op, left, right)
+	}
+
+	return vm.push(&object.Integer{Value: value})
+}
+
+func (vm *VM) executeBigIntBinaryOperation(op code.Opcode, left, right object.Object) *object.Error {
+	return vm.pushResult(object.BigIntInfix(operators[op], left, right, vm.checked))
+}
+
+// pushResult pushes the result of an operation in the object package,
+// raising it instead if it is an error
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeFloatBinaryOperation(op code.Opcode, leftValue, rightValue float64) *object.Error {
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		return vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "unknown operator: %s", operators[op])
+	}
+}
+
+func (vm *VM) executeStringBinaryOperation(op code.Opcode, left, right object.Object) *object.Error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftValue + rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "operartor %s not supported on type string", operators[op])
+	}
+}
+
+func (vm *VM) executeBangOperator() *object.Error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() *object.Error {
+	return vm.pushResult(object.Negate(vm.pop(), vm.checked))
+}
+
+func (vm *VM) executeBitNotOperator() *object.Error {
+	return vm.pushResult(object.BitNot(vm.pop()))
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// buildString joins the parts of an interpolated string the way the
+// evaluator does, using what Inspect gives for each
+func (vm *VM) buildString(startIndex, endIndex int) object.Object {
+	var buf strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		buf.WriteString(vm.stack[i].Inspect())
+	}
+
+	return &object.String{Value: buf.String()}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, newErrorf(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+// same rules as the evaluator, negative indexes count from the end and
+// anything out of range is null
+func normalizeIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+
+	return int(index), true
+}
+
+// arrays & hashes are changed in place, see evalIndexAssignment in the
+// evaluator
+func (vm *VM) executeIndexAssignment(left, index, value object.Object) *object.Error {
+	switch {
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newErrorf(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+		}
+
+		left.(*object.Hash).Set(key, value)
+
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+
+		// big integers are always out of range
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return newErrorf(object.INDEX_ERROR, "index out of range: %s", index.Inspect())
+		}
+
+		i, ok := normalizeIndex(integer.Value, len(elements))
+		if !ok {
+			return newErrorf(object.INDEX_ERROR, "index out of range: %s", index.Inspect())
+		}
+
+		elements[i] = value
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "index assignment not supported: %s[%s]", left.Type(), index.Type())
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) *object.Error {
+	switch {
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+
+		// big integers are always out of range
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return vm.push(Null)
+		}
+
+		i, ok := normalizeIndex(integer.Value, len(elements))
+		if !ok {
+			return vm.push(Null)
+		}
+
+		return vm.push(elements[i])
+
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		value := left.(*object.String).Value
+
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return vm.push(Null)
+		}
+
+		i, ok := normalizeIndex(integer.Value, len(value))
+		if !ok {
+			return vm.push(Null)
+		}
+
+		return vm.push(&object.String{Value: value[i : i+1]})
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) *object.Error {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newErrorf(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.(*object.Hash).Get(key)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+
+	default:
+		return newErrorf(object.TYPE_ERROR, "not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return newErrorf(object.ARGUMENT_ERROR, "wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	// the arguments are already in place as the first locals
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= StackSize {
+		return newErrorf(object.RUNTIME_ERROR, "stack overflow")
+	}
+
+	// the other locals may hold cells left behind by an earlier call
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+
+	if result == nil {
+		return vm.push(Null)
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) *object.Error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return newErrorf(object.TYPE_ERROR, "not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
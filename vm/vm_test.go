@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/cijin/go-interpreter/compiler"
+	"github.com/cijin/go-interpreter/lexer"
+	"github.com/cijin/go-interpreter/object"
+	"github.com/cijin/go-interpreter/parser"
+)
+
+func run(t *testing.T, input string) (object.Object, error) {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	result, err := run(t, "1; return 2; 3;")
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 2 {
+		t.Errorf("expected 2, got=%+v", result)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\n  x + true", "2:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() { g() };\nf()", "1:16: identifier is undefined: g"},
+		{"let f = fn() { f() }; f()", "1:16: stack overflow"},
+		{"1(2)", "1:1: not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.input)
+		if err == nil {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+
+		objErr, ok := err.(*object.Error)
+		if !ok {
+			t.Errorf("expected *object.Error, got=%T", err)
+			continue
+		}
+
+		if objErr.Inspect() != tt.expected {
+			t.Errorf("expected %q, got=%q", tt.expected, objErr.Inspect())
+		}
+	}
+}
+
+func TestGlobalsStore(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, name := range object.Builtins.Names() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	globals := NewGlobalsStore()
+	constants := []object.Object{}
+
+	for _, input := range []string{"let x = 5;", "let y = x * 2;"} {
+		comp := compiler.NewWithState(symbolTable, constants, object.Builtins)
+		if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		if err := NewWithGlobalsStore(bytecode, globals).Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+
+	y, ok := symbolTable.Resolve("y")
+	if !ok {
+		t.Fatalf("y is not defined")
+	}
+
+	integer, ok := globals[y.Index].(*object.Integer)
+	if !ok || integer.Value != 10 {
+		t.Errorf("expected y to be 10, got=%+v", globals[y.Index])
+	}
+}